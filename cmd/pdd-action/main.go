@@ -2,21 +2,55 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/ksysoev/pdd-action/pkg/export"
 	"github.com/ksysoev/pdd-action/pkg/github"
+	"github.com/ksysoev/pdd-action/pkg/logging"
 	"github.com/sethvargo/go-githubactions"
 )
 
+// version is the version of the action, set at build time with -ldflags "-X main.version=v1.2.3"
+var version = "dev"
+
 func main() {
 	// Set up action
 	action := githubactions.New()
-	ctx := context.Background()
+	// A cancelled workflow run sends SIGTERM, the issues created before it are still written back
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger, err := newLogger(action)
+	if err != nil {
+		action.Fatalf("Invalid logging configuration: %v", err)
+	}
+	slog.SetDefault(logger)
+
+	// GitHub App credentials take precedence over the token when provided
+	appID, err := strconv.ParseInt(inputOrEnv(action, "app_id", "PDD_APP_ID", "0"), 10, 64)
+	if err != nil {
+		fatalf("app_id must be a number: %v", err)
+	}
+	appPrivateKey := inputOrEnv(action, "private_key", "PDD_APP_PRIVATE_KEY", "")
+	if appID != 0 && appPrivateKey == "" {
+		fatalf("private_key input is required when app_id is set")
+	}
+	appInstallationID, err := strconv.ParseInt(inputOrEnv(action, "app_installation_id", "PDD_APP_INSTALLATION_ID", "0"), 10, 64)
+	if err != nil {
+		fatalf("app_installation_id must be a number: %v", err)
+	}
 
 	// Get action inputs - first try action inputs, then fall back to env vars
 	githubToken := action.GetInput("github_token")
@@ -28,14 +62,17 @@ func main() {
 			if githubToken == "" {
 				// Final fallback to catch other possible env var names
 				githubToken = os.Getenv("GH_TOKEN")
-				if githubToken == "" {
-					action.Fatalf("github_token input is required")
+				if githubToken == "" && appID == 0 {
+					fatalf("github_token input is required")
 				}
 			}
 		}
 	}
-	
-	action.Infof("GitHub token is present with length: %d", len(githubToken))
+
+	// Secrets are masked before anything can log them
+	logging.AddMask(logger, githubToken)
+	logging.AddMask(logger, appPrivateKey)
+	slog.Debug("GitHub credentials configured", "token", githubToken != "", "app_id", appID)
 
 	branchName := action.GetInput("branch_name")
 	if branchName == "" {
@@ -50,144 +87,731 @@ func main() {
 		issueTitlePrefix = os.Getenv("PDD_ISSUE_PREFIX")
 	}
 
+	checkConclusion := action.GetInput("check_conclusion")
+	if checkConclusion == "" {
+		checkConclusion = os.Getenv("PDD_CHECK_CONCLUSION")
+		if checkConclusion == "" {
+			checkConclusion = "neutral"
+		}
+	}
+	if checkConclusion != "neutral" && checkConclusion != "failure" {
+		fatalf("check_conclusion must be either neutral or failure, got: %s", checkConclusion)
+	}
+
+	concurrencyInput := inputOrEnv(action, "concurrency", "PDD_CONCURRENCY", strconv.Itoa(github.DefaultConcurrency))
+	concurrency, err := strconv.Atoi(concurrencyInput)
+	if err != nil || concurrency < 1 {
+		fatalf("concurrency must be a positive number, got: %s", concurrencyInput)
+	}
+
+	maxFileSize, err := strconv.ParseInt(inputOrEnv(action, "max_file_size", "PDD_MAX_FILE_SIZE", strconv.Itoa(core.DefaultMaxFileSize)), 10, 64)
+	if err != nil {
+		fatalf("max_file_size must be a number of bytes: %v", err)
+	}
+
+	issueReference, err := core.ParseReferenceStyle(inputOrEnv(action, "issue_reference", "PDD_ISSUE_REFERENCE", string(core.ReferenceURL)))
+	if err != nil {
+		fatalf("Invalid issue_reference: %v", err)
+	}
+
+	issuePlacement := inputOrEnv(action, "issue_placement", "PDD_ISSUE_PLACEMENT", "todo")
+	if issuePlacement != "todo" && issuePlacement != "labels" {
+		fatalf("issue_placement must be one of todo or labels, got: %s", issuePlacement)
+	}
+
+	redactMode, err := core.ParseRedactMode(inputOrEnv(action, "redact", "PDD_REDACT", string(core.RedactMask)))
+	if err != nil {
+		fatalf("Invalid redact: %v", err)
+	}
+	redactPatterns := strings.Split(inputOrEnv(action, "redact_patterns", "PDD_REDACT_PATTERNS", ""), "\n")
+	if _, err := core.NewRedactor(redactPatterns); err != nil {
+		fatalf("Invalid redact_patterns: %v", err)
+	}
+
+	failOn, err := core.ParseFailPolicy(inputOrEnv(action, "fail_on", "PDD_FAIL_ON", string(core.FailOnAny)))
+	if err != nil {
+		fatalf("Invalid fail_on: %v", err)
+	}
+
+	compensate, err := strconv.ParseBool(inputOrEnv(action, "compensate", "PDD_COMPENSATE", "false"))
+	if err != nil {
+		fatalf("compensate must be true or false: %v", err)
+	}
+	writeBackAttemptsInput := inputOrEnv(action, "write_back_attempts", "PDD_WRITE_BACK_ATTEMPTS", strconv.Itoa(github.DefaultWriteBackAttempts))
+	writeBackAttempts, err := strconv.Atoi(writeBackAttemptsInput)
+	if err != nil || writeBackAttempts < 1 {
+		fatalf("write_back_attempts must be a positive number, got: %s", writeBackAttemptsInput)
+	}
+	retryPath := inputOrEnv(action, "retry_path", "PDD_RETRY_PATH", core.DefaultRetryPath)
+
+	terminators, err := core.ParseTerminators(inputOrEnv(action, "puzzle_terminators", "PDD_PUZZLE_TERMINATORS", "end"))
+	if err != nil {
+		fatalf("Invalid puzzle_terminators: %v", err)
+	}
+
+	ledgerMode := inputOrEnv(action, "ledger", "PDD_LEDGER", "")
+	if ledgerMode == "none" {
+		ledgerMode = ""
+	}
+	if ledgerMode != "" && ledgerMode != "file" && ledgerMode != "branch" {
+		fatalf("ledger must be one of none, file or branch, got: %s", ledgerMode)
+	}
+	ledgerPath := inputOrEnv(action, "ledger_path", "PDD_LEDGER_PATH", core.DefaultLedgerPath)
+	ledgerBranch := inputOrEnv(action, "ledger_branch", "PDD_LEDGER_BRANCH", "pdd-ledger")
+
+	exportFormat := inputOrEnv(action, "export_format", "PDD_EXPORT_FORMAT", "")
+	if exportFormat != "" {
+		if _, err := export.ParseFormat(exportFormat); err != nil {
+			fatalf("Invalid export_format: %v", err)
+		}
+	}
+	exportPath := inputOrEnv(action, "export_path", "PDD_EXPORT_PATH", "")
+
+	apiURL := inputOrEnv(action, "github_api_url", "GITHUB_API_URL", core.DefaultAPIURL)
+	serverURL := inputOrEnv(action, "github_server_url", "GITHUB_SERVER_URL", core.ServerURLFromAPIURL(apiURL))
+
 	// Get GitHub context
 	eventName := os.Getenv("GITHUB_EVENT_NAME")
 	if eventName != "pull_request" && eventName != "workflow_dispatch" && eventName != "push" {
-		action.Fatalf("This action only works on pull_request, workflow_dispatch, or push events, got: %s", eventName)
+		fatalf("This action only works on pull_request, workflow_dispatch, or push events, got: %s", eventName)
 	}
 
 	repoFullName := os.Getenv("GITHUB_REPOSITORY")
 	if repoFullName == "" {
-		action.Fatalf("GITHUB_REPOSITORY environment variable is not set")
+		fatalf("GITHUB_REPOSITORY environment variable is not set")
 	}
 
 	var prNumber int
-	var err error
+	var prEvent pullRequestEvent
 	
+	if eventName == "pull_request" {
+		prEvent, err = readPullRequestEvent(os.Getenv("GITHUB_EVENT_PATH"))
+		if err != nil {
+			slog.Warn("Failed to read pull request event payload", "error", err)
+		}
+	}
+
 	if eventName == "workflow_dispatch" || eventName == "push" {
 		// In workflow_dispatch or push mode, use a dummy PR number
 		prNumber = 1
-		action.Infof("Running in %s mode - using dummy PR number: %d", eventName, prNumber)
+		slog.Info("Running without a pull request, using dummy PR number", "event", eventName, "pr", prNumber)
 	} else {
 		prString := os.Getenv("GITHUB_REF")
 		prNumber, err = extractPRNumber(prString)
 		if err != nil {
-			action.Fatalf("Failed to extract PR number: %v", err)
+			fatalf("Failed to extract PR number: %v", err)
 		}
 	}
 
 	// Get workspace path
 	workspacePath := os.Getenv("GITHUB_WORKSPACE")
 	if workspacePath == "" {
-		action.Fatalf("GITHUB_WORKSPACE environment variable is not set")
+		fatalf("GITHUB_WORKSPACE environment variable is not set")
+	}
+
+	// Register the languages declared in the repository configuration before scanning
+	configFile := inputOrEnv(action, "config_file", "PDD_CONFIG_FILE", core.DefaultConfigFile)
+	if !filepath.IsAbs(configFile) {
+		configFile = filepath.Join(workspacePath, configFile)
+	}
+	fileConfig, err := core.LoadFileConfig(configFile)
+	if err != nil {
+		fatalf("Failed to load configuration: %v", err)
+	}
+	if len(fileConfig.Languages) > 0 {
+		if err := core.RegisterLanguages(fileConfig.Languages); err != nil {
+			fatalf("Invalid languages in %s: %v", configFile, err)
+		}
+		slog.Info("Registered languages", "count", len(fileConfig.Languages), "path", configFile)
 	}
 
 	// Initialize config
 	config := core.Config{
-		GitHubToken:      githubToken,
-		BranchName:       branchName,
-		IssueTitlePrefix: issueTitlePrefix,
+		GitHubToken:       githubToken,
+		AppID:             appID,
+		AppPrivateKey:     appPrivateKey,
+		AppInstallation:   appInstallationID,
+		BranchName:        branchName,
+		IssueTitlePrefix:  issueTitlePrefix,
+		APIURL:            apiURL,
+		ServerURL:         serverURL,
+		Concurrency:       concurrency,
+		MaxFileSize:       maxFileSize,
+		Terminators:       terminators,
+		IssueReference:    issueReference,
+		IssueAfterLabels:  issuePlacement == "labels",
+		CheckConclusion:   checkConclusion,
+		LedgerMode:        ledgerMode,
+		LedgerPath:        ledgerPath,
+		LedgerBranch:      ledgerBranch,
+		ExportFormat:      exportFormat,
+		ExportPath:        exportPath,
+		RedactMode:        redactMode,
+		RedactPatterns:    redactPatterns,
+		FailOn:            failOn,
+		Compensate:        compensate,
+		RetryPath:         retryPath,
+		WriteBackAttempts: writeBackAttempts,
 	}
 
 	// Initialize GitHub client
-	client := github.NewClient(githubToken, repoFullName, config)
+	client, err := newClient(config, repoFullName)
+	if err != nil {
+		fatalf("Failed to create GitHub client: %v", err)
+	}
+
+	// Open or updated pull requests only get a check run previewing new puzzles,
+	// issues are created once the pull request is merged
+	if prEvent.isOpenOrUpdated() {
+		slog.Info("Reporting new puzzles of the pull request as a check run", "pr", prNumber, "action", prEvent.Action)
+
+		comments := scanWorkspace(ctx, config, workspacePath)
+
+		// Puzzles already tracked in the ledger are not new even if their Issue: line is missing
+		if config.LedgerMode != "" {
+			ledgerRef := branchName
+			if config.LedgerMode == "branch" {
+				ledgerRef = config.LedgerBranch
+			}
+
+			ledger, _, err := client.LoadLedger(ctx, config.LedgerPath, ledgerRef)
+			if err != nil {
+				slog.Warn("Failed to load ledger", "error", err)
+			} else {
+				comments = ledger.Reconcile(comments, time.Now()).Comments
+			}
+		}
+
+		exportInventory(action, config, workspacePath, comments)
+
+		unprocessedComments := core.FilterUnprocessedComments(comments)
+		slog.Info("Found unprocessed TODO comments", "count", len(unprocessedComments))
+
+		publish, blocked := redactComments(config, unprocessedComments)
+		if err := client.CreatePuzzleCheckRun(ctx, prEvent.PullRequest.Head.SHA, publish); err != nil {
+			fatalf("Failed to create check run: %v", err)
+		}
+		if blocked > 0 {
+			fatalf("%d puzzles contain secrets and were not published", blocked)
+		}
+
+		slog.Info("PDD Action completed successfully")
+		return
+	}
 
 	// For workflow_dispatch or push, skip PR merged check
 	if eventName != "workflow_dispatch" && eventName != "push" {
 		// Check if PR is merged to target branch
 		isMerged, err := client.IsPRMergedToTargetBranch(ctx, prNumber)
 		if err != nil {
-			action.Fatalf("Failed to check if PR is merged: %v", err)
+			fatalf("Failed to check if PR is merged: %v", err)
 		}
 	
 		if !isMerged {
-			action.Infof("PR #%d is not merged to %s branch yet. Skipping issue creation.", prNumber, branchName)
+			slog.Info("Pull request is not merged to the target branch yet, skipping issue creation", "pr", prNumber, "branch", branchName)
 			return
 		}
 	} else {
-		action.Infof("Running in %s mode - skipping PR merged check", eventName)
-		action.Infof("Using target branch for issues: %s", branchName)
+		slog.Info("Skipping pull request merged check", "event", eventName, "branch", branchName)
 	}
 
+	// Get PR head branch name or use current branch for workflow_dispatch/push
+	prBranch := resolvePRBranch(ctx, client, eventName, config, prNumber)
+
 	// Scan workspace for TODO comments
-	excludeDirs := []string{
-		filepath.Join(workspacePath, ".git"),
-		filepath.Join(workspacePath, "node_modules"),
-		filepath.Join(workspacePath, "vendor"),
+	comments := scanWorkspace(ctx, config, workspacePath)
+
+	// Link puzzles whose marker references an issue, such as TODO(#123):, so it's never recreated
+	for i, comment := range comments {
+		if comment.IssueURL != "" || comment.IssueRef == "" {
+			continue
+		}
+		if ref, ok := client.IssueRefFromReference(comment.IssueRef); ok {
+			comments[i].IssueURL = ref.URL(client.ServerURL())
+		}
 	}
 
-	action.Infof("Scanning for TODO comments in workspace: %s", workspacePath)
-	comments, err := core.ScanDirectory(workspacePath, excludeDirs)
-	if err != nil {
-		action.Fatalf("Failed to scan directory: %v", err)
+	for _, comment := range comments {
+		if comment.IssueURL == "" {
+			continue
+		}
+		if _, ok := client.IssueRefFromURL(comment.IssueURL); !ok {
+			slog.Warn("Issue URL does not point to an issue on the server", "url", comment.IssueURL, "location", comment.Location(), "server", client.ServerURL())
+		}
 	}
 
-	action.Infof("Found %d TODO comments", len(comments))
+	var ledger *core.Ledger
+	var ledgerSHA string
+	ledgerRef := prBranch
+	if config.LedgerMode == "branch" {
+		ledgerRef = config.LedgerBranch
+	}
+
+	// Write-backs that failed in previous runs are queued in the ledger or, without one, in the retry manifest
+	var queue core.RetryQueue
+	if !filepath.IsAbs(retryPath) {
+		retryPath = filepath.Join(workspacePath, retryPath)
+	}
+	if config.LedgerMode != "" {
+		ledger, ledgerSHA, err = client.LoadLedger(ctx, config.LedgerPath, ledgerRef)
+		if err != nil {
+			fatalf("Failed to load ledger: %v", err)
+		}
+		queue = ledger.Retries
+	} else if queue, err = core.LoadRetryManifest(retryPath); err != nil {
+		slog.Warn("Failed to load retry manifest", "path", retryPath, "error", err)
+	}
+
+	comments, retryComments := queue.Take(comments)
+	if len(retryComments) > 0 {
+		slog.Info("Retrying write-backs that failed in previous runs", "count", len(retryComments))
+	}
+
+	// Reconcile scanned comments with the ledger, restoring issue URLs that were removed from the code
+	var restoredComments []core.TodoComment
+	if ledger != nil {
+		result := ledger.Reconcile(comments, time.Now())
+		comments = result.Comments
+		restoredComments = result.Restored
+		slog.Info("Ledger reconciled", "restored", len(result.Restored), "adopted", result.Adopted, "removed", result.Removed)
+
+		if err := client.RefreshLedgerStates(ctx, ledger); err != nil {
+			slog.Warn("Failed to refresh ledger issue states", "error", err)
+		}
+	}
 
 	// Filter out already processed comments
 	unprocessedComments := core.FilterUnprocessedComments(comments)
-	action.Infof("Found %d unprocessed TODO comments", len(unprocessedComments))
+	slog.Info("Found unprocessed TODO comments", "count", len(unprocessedComments))
 
-	if len(unprocessedComments) == 0 {
-		action.Infof("No unprocessed TODO comments found. Exiting.")
+	if len(unprocessedComments) == 0 && len(retryComments) == 0 && ledger == nil && config.ExportFormat == "" {
+		if err := core.SaveRetryManifest(retryPath, nil); err != nil {
+			slog.Warn("Failed to remove retry manifest", "error", err)
+		}
+		slog.Info("No unprocessed TODO comments found, exiting")
+		reportResult(action, config, 0, 0, 0, &github.MultiError{})
 		return
 	}
 
-	// Create issues from unprocessed comments
-	processedComments, err := client.CreateIssuesFromComments(ctx, unprocessedComments)
+	// Mask or hold back secrets before the text of the puzzles is published
+	publish, blocked := redactComments(config, unprocessedComments)
+
+	// Create issues from unprocessed comments, the puzzles that fail are reported at the end
+	var failures github.MultiError
+	var processedComments []core.TodoComment
+	var interrupted error
+	if len(publish) > 0 {
+		endGroup := logging.Group(logger, "Creating issues")
+		processedComments, err = client.CreateIssuesFromComments(ctx, publish)
+		endGroup()
+		var createErrs *github.MultiError
+		if errors.As(err, &createErrs) {
+			failures.Add(createErrs.Errors...)
+		} else if err != nil {
+			// The issues created before the interruption are still written back and recorded
+			// below, so the next run doesn't create them again
+			interrupted = err
+			ctx = context.WithoutCancel(ctx)
+		}
+
+		// Issues were created from masked text, the comments keep their text so fingerprints match the code
+		processedComments = restoreText(processedComments, unprocessedComments)
+		slog.Info("Created issues from TODO comments", "count", len(processedComments))
+	}
+
+	// Export the inventory with the URLs of the issues created in this run
+	issueURLs := make(map[string]string, len(processedComments))
+	for _, comment := range processedComments {
+		issueURLs[comment.Location()] = comment.IssueURL
+	}
+	for i := range comments {
+		if url, ok := issueURLs[comments[i].Location()]; ok {
+			comments[i].IssueURL = url
+		}
+	}
+	exportInventory(action, config, workspacePath, comments)
+
+	if ledger != nil {
+		for _, comment := range processedComments {
+			ledger.Record(comment, time.Now())
+		}
+	}
+
+	// Update comments in PR files, the retries of previous runs first, then the issues created
+	// in this run and the ones whose issue URL was restored from the ledger
+	endGroup := logging.Group(logger, "Updating TODO comments")
+	writeBack := slices.Concat(retryComments, processedComments, restoredComments)
+	created := make(map[string]bool, len(processedComments))
+	for _, comment := range processedComments {
+		created[comment.IssueURL] = true
+	}
+	retries := updateComments(ctx, client, config, writeBack, created, prNumber, prBranch, queue, ledger, &failures)
+	endGroup()
+
+	var ledgerErr error
+	if ledger != nil {
+		ledger.Retries = retries
+		ledgerErr = saveLedger(ctx, client, config, workspacePath, ledgerRef, ledger, ledgerSHA)
+	} else {
+		saveRetryManifest(action, retryPath, retries)
+	}
+
+	if interrupted != nil {
+		fatalf("Failed to create issues: %v", interrupted)
+	}
+	if ledgerErr != nil {
+		slog.Error(fmt.Sprintf("Failed to save ledger: %v", ledgerErr))
+	}
+
+	reportResult(action, config, len(publish)+len(writeBack)-len(processedComments), len(processedComments), blocked, &failures)
+
+	// Without the ledger the next run would lose the queued write-backs and the issues created in this run
+	if ledgerErr != nil {
+		os.Exit(1)
+	}
+
+	slog.Info("PDD Action completed successfully")
+}
+
+// updateComments writes the issue references back to the TODO comments. A failed write-back
+// is recorded in failures and queued for the next run. When configured, the failed write-back
+// of an issue created in this run, listed in created, is compensated by closing the orphan
+// issue instead, existing issues are never closed. It returns the queue of write-backs to retry.
+func updateComments(ctx context.Context, client *github.Client, config core.Config, comments []core.TodoComment, created map[string]bool, prNumber int, branch string, previous core.RetryQueue, ledger *core.Ledger, failures *github.MultiError) core.RetryQueue {
+	var retries core.RetryQueue
+	for _, comment := range comments {
+		err := client.UpdateCommentInFile(ctx, comment, prNumber, branch)
+		if err == nil {
+			slog.Info("Updated TODO comment with issue URL", "location", comment.Location(), "url", comment.IssueURL)
+			continue
+		}
+		failures.Add(github.NewPuzzleError(github.OpUpdateComment, comment, err))
+
+		if config.Compensate && created[comment.IssueURL] {
+			cerr := client.CloseOrphanIssue(ctx, comment, err)
+			if cerr == nil {
+				// The puzzle gets a new issue on the next run
+				if ledger != nil {
+					ledger.Forget(comment.Fingerprint())
+				}
+				continue
+			}
+			slog.Warn("Failed to close orphan issue, queueing the write-back for the next run", "url", comment.IssueURL, "error", cerr)
+		}
+
+		retries.Add(comment, err, previous, time.Now())
+	}
+	return retries
+}
+
+// saveRetryManifest writes the queue of write-backs to retry to the retry manifest and exposes
+// its path as a step output, so the workflow can carry it to the next run as an artifact
+func saveRetryManifest(action *githubactions.Action, path string, retries core.RetryQueue) {
+	if err := core.SaveRetryManifest(path, retries); err != nil {
+		slog.Warn("Failed to save retry manifest", "error", err)
+		return
+	}
+	if len(retries) == 0 {
+		return
+	}
+
+	slog.Warn("Write-backs queued for the next run", "count", len(retries), "path", path)
+	action.SetOutput("retry_manifest", path)
+}
+
+// reportResult sets the step outputs describing the outcome of processing attempted puzzles,
+// created of which got an issue, and reports every failure. Puzzles blocked for containing
+// secrets count as failed and always fail the run, other failures fail it according to the
+// fail_on policy. A failed run exits with status 1 if every puzzle failed and 2 if only some did.
+func reportResult(action *githubactions.Action, config core.Config, attempted, created, blocked int, failures *github.MultiError) {
+	failed := failures.Failed() + blocked
+	result := core.Outcome(attempted+blocked, failed)
+	action.SetOutput("result", string(result))
+	action.SetOutput("issues_created", strconv.Itoa(created))
+	action.SetOutput("puzzles_failed", strconv.Itoa(failed))
+	action.SetOutput("error_categories", failures.Summary())
+
+	fails := config.FailOn.Fails(result) || blocked > 0
+	for _, err := range failures.Errors {
+		// The file and line attributes turn the record into an annotation on the puzzle
+		annotation := slog.With("file", err.Comment.FilePath, "line", err.Comment.LineNumber, "category", err.Category)
+		if fails {
+			annotation.Error(err.Error())
+		} else {
+			annotation.Warn(err.Error())
+		}
+	}
+
+	if result == core.ResultSuccess {
+		return
+	}
+	if !fails {
+		slog.Warn("Some puzzles failed, not failing the run", "result", result, "fail_on", config.FailOn, "errors", failures.Summary())
+		return
+	}
+
+	if blocked > 0 {
+		slog.Error(fmt.Sprintf("%d puzzles contain secrets and were not published", blocked), "result", result)
+	}
+	if failures.Failed() > 0 {
+		slog.Error(fmt.Sprintf("%d of %d puzzles failed: %s", failures.Failed(), attempted, failures.Summary()), "result", result)
+	}
+	if result == core.ResultPartial {
+		os.Exit(2)
+	}
+	os.Exit(1)
+}
+
+// redactComments applies the configured redaction to the comments about to be published,
+// annotating the puzzles in which secrets were found. It returns the comments to publish
+// and the number of puzzles held back in block mode.
+func redactComments(config core.Config, comments []core.TodoComment) ([]core.TodoComment, int) {
+	publish, findings := core.RedactComments(comments, newRedactor(config), config.RedactMode)
+	for _, finding := range findings {
+		// The file and line attributes turn the record into an annotation on the puzzle
+		annotation := slog.With("file", finding.Comment.FilePath, "line", finding.Comment.LineNumber)
+		detectors := strings.Join(finding.Detectors, ", ")
+		if config.RedactMode == core.RedactBlock {
+			annotation.Error(fmt.Sprintf("TODO comment contains secrets (%s) and was not published", detectors))
+		} else {
+			annotation.Warn(fmt.Sprintf("Secrets (%s) were masked in the issue created from this TODO comment", detectors))
+		}
+	}
+
+	if config.RedactMode == core.RedactBlock {
+		return publish, len(findings)
+	}
+	return publish, 0
+}
+
+// newRedactor creates the redactor masking secrets in the text of puzzles that is published,
+// exported or logged, nil when redaction is off
+func newRedactor(config core.Config) *core.Redactor {
+	if config.RedactMode == core.RedactOff {
+		return nil
+	}
+	redactor, err := core.NewRedactor(config.RedactPatterns)
 	if err != nil {
-		action.Fatalf("Failed to create issues: %v", err)
+		fatalf("Invalid redact_patterns: %v", err)
 	}
+	return redactor
+}
 
-	action.Infof("Created %d issues from TODO comments", len(processedComments))
+// restoreText restores the original title and description of processed comments created
+// from masked copies of originals
+func restoreText(processed, originals []core.TodoComment) []core.TodoComment {
+	byLocation := make(map[string]core.TodoComment, len(originals))
+	for _, comment := range originals {
+		byLocation[comment.Location()] = comment
+	}
+	for i, comment := range processed {
+		if original, ok := byLocation[comment.Location()]; ok {
+			processed[i].Title = original.Title
+			processed[i].Description = original.Description
+		}
+	}
+	return processed
+}
 
-	// Get PR head branch name or use current branch for workflow_dispatch/push
-	var prBranch string
+// inputOrEnv returns the action input, falling back to the environment variable and then the default value
+func inputOrEnv(action *githubactions.Action, input, env, defaultValue string) string {
+	if value := action.GetInput(input); value != "" {
+		return value
+	}
+	if value := os.Getenv(env); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// newLogger creates the logger configured by the log_format and log_level inputs. Inside
+// GitHub Actions records are written as workflow commands, with debug records shown only
+// when step debug logging is enabled, otherwise as text lines.
+func newLogger(action *githubactions.Action) (*slog.Logger, error) {
+	defaultFormat := logging.FormatText
+	if os.Getenv("GITHUB_ACTIONS") == "true" {
+		defaultFormat = logging.FormatActions
+	}
+	format, err := logging.ParseFormat(inputOrEnv(action, "log_format", "PDD_LOG_FORMAT", string(defaultFormat)))
+	if err != nil {
+		return nil, err
+	}
+
+	defaultLevel := "info"
+	if format == logging.FormatActions || os.Getenv("RUNNER_DEBUG") == "1" {
+		defaultLevel = "debug"
+	}
+	level, err := logging.ParseLevel(inputOrEnv(action, "log_level", "PDD_LOG_LEVEL", defaultLevel))
+	if err != nil {
+		return nil, err
+	}
+
+	return logging.New(os.Stdout, format, level), nil
+}
+
+// fatalf logs an error and exits with a failure status
+func fatalf(format string, args ...any) {
+	slog.Error(fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// resolvePRBranch returns the branch TODO comments are updated on
+func resolvePRBranch(ctx context.Context, client *github.Client, eventName string, config core.Config, prNumber int) string {
 	if eventName == "workflow_dispatch" || eventName == "push" {
 		// Use the configured branch or fallback to GitHub ref
-		prBranch = branchName
+		prBranch := config.BranchName
 		
 		// For development testing, use actual git branch if possible
 		if prBranch == "main" && os.Getenv("GITHUB_REF_NAME") != "" {
 			prBranch = os.Getenv("GITHUB_REF_NAME")
 		}
 		
-		action.Infof("Using branch for %s: %s", eventName, prBranch)
-	} else {
-		githubClient := github.NewRawClient(githubToken)
-		
-		// Split repository owner and name safely
-		repoParts := strings.Split(repoFullName, "/")
-		owner := repoParts[0]
-		repo := ""
-		if len(repoParts) > 1 {
-			repo = repoParts[1]
-		} else {
-			repo = repoFullName
-			owner = os.Getenv("GITHUB_REPOSITORY_OWNER")
-			if owner == "" {
-				owner = "unknown"
-			}
+		slog.Info("Using branch for TODO comment updates", "event", eventName, "branch", prBranch)
+		return prBranch
+	}
+
+	prBranch, err := client.PullRequestHeadRef(ctx, prNumber)
+	if err != nil {
+		fatalf("Failed to get PR details: %v", err)
+	}
+	return prBranch
+}
+
+// newClient creates the GitHub client authenticated as a GitHub App installation when
+// app credentials are configured, or with the token otherwise
+func newClient(config core.Config, repoFullName string) (*github.Client, error) {
+	if config.AppID == 0 {
+		return github.NewClient(config.GitHubToken, repoFullName, config)
+	}
+
+	owner, repo := github.SplitRepository(repoFullName)
+	ts, err := github.NewAppTokenSource(config.AppID, []byte(config.AppPrivateKey), config.AppInstallation, owner, repo, config)
+	if err != nil {
+		return nil, err
+	}
+	return github.NewClientWithTokenSource(ts, repoFullName, config)
+}
+
+// saveLedger commits the ledger to its branch and, in file mode, also updates the workspace copy
+func saveLedger(ctx context.Context, client *github.Client, config core.Config, workspacePath, branch string, ledger *core.Ledger, sha string) error {
+	if err := client.SaveLedger(ctx, config.LedgerPath, branch, ledger, sha); err != nil {
+		return err
+	}
+
+	if config.LedgerMode == "file" {
+		if err := core.SaveLedgerFile(filepath.Join(workspacePath, config.LedgerPath), ledger); err != nil {
+			slog.Warn("Failed to write ledger to workspace", "error", err)
 		}
-		
-		prDetails, _, err := githubClient.PullRequests.Get(ctx, owner, repo, prNumber)
-		if err != nil {
-			action.Fatalf("Failed to get PR details: %v", err)
+	}
+
+	summary := ledger.Summary()
+	slog.Log(context.Background(), logging.LevelNotice, "Ledger saved", "path", config.LedgerPath, "open", summary[core.LedgerStatusOpen], "closed", summary[core.LedgerStatusClosed], "removed", summary[core.LedgerStatusRemoved])
+	return nil
+}
+
+// exportInventory writes the puzzle inventory in the configured format and exposes its path as a step output
+func exportInventory(action *githubactions.Action, config core.Config, workspacePath string, comments []core.TodoComment) {
+	if config.ExportFormat == "" {
+		return
+	}
+
+	format, err := export.ParseFormat(config.ExportFormat)
+	if err != nil {
+		fatalf("Invalid export_format: %v", err)
+	}
+
+	path := config.ExportPath
+	if path == "" {
+		path = "pdd-puzzles." + string(format)
+		if format == export.FormatXML {
+			path = "puzzles.xml"
 		}
-		prBranch = prDetails.GetHead().GetRef()
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workspacePath, path)
 	}
 
-	// Update comments in PR files
-	for _, comment := range processedComments {
-		err := client.UpdateCommentInFile(ctx, comment, prNumber, prBranch)
-		if err != nil {
-			action.Warningf("Failed to update comment in file %s: %v", comment.FilePath, err)
-		} else {
-			action.Infof("Updated TODO comment in %s with issue URL: %s", comment.FilePath, comment.IssueURL)
+	// Puzzles held back in block mode are still listed, the secrets in every puzzle are masked
+	opts := export.Options{GeneratedAt: time.Now(), ToolVersion: version, Redactor: newRedactor(config)}
+	err = export.WriteFile(path, format, comments, opts)
+	if err != nil {
+		fatalf("Failed to export puzzles: %v", err)
+	}
+
+	slog.Info("Exported puzzles", "count", len(comments), "format", format, "path", path)
+	action.SetOutput("export_path", path)
+}
+
+// scanWorkspace scans the workspace for TODO comments with paths relative to the workspace
+func scanWorkspace(ctx context.Context, config core.Config, workspacePath string) []core.TodoComment {
+	opts := core.ScanOptions{
+		ExcludeDirs: []string{
+			filepath.Join(workspacePath, ".git"),
+			filepath.Join(workspacePath, "node_modules"),
+			filepath.Join(workspacePath, "vendor"),
+		},
+		MaxFileSize: config.MaxFileSize,
+		Terminators: config.Terminators,
+	}
+
+	defer logging.Group(slog.Default(), "Scanning for TODO comments")()
+
+	slog.Info("Scanning for TODO comments in workspace", "path", workspacePath)
+	comments, err := core.ScanDirectoryWithOptions(ctx, workspacePath, opts)
+	if err != nil {
+		fatalf("Failed to scan directory: %v", err)
+	}
+
+	comments = core.RelativePaths(comments, workspacePath)
+
+	slog.Info("Found TODO comments", "count", len(comments))
+	redactor := newRedactor(config)
+	for _, comment := range comments {
+		if comment.Ignored {
+			// Suppressed puzzles are listed so audits can find them
+			slog.Info("Ignored TODO comment", "location", comment.Location(), "title", redactor.Mask(comment).Title)
 		}
 	}
+	return comments
+}
+
+// pullRequestEvent holds the fields of the pull_request event payload used by the action
+type pullRequestEvent struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			SHA string `json:"sha"`
+		} `json:"head"`
+	} `json:"pull_request"`
+}
+
+// isOpenOrUpdated reports whether the event is for a pull request that was opened or received new commits
+func (e pullRequestEvent) isOpenOrUpdated() bool {
+	switch e.Action {
+	case "opened", "synchronize", "reopened":
+		return e.PullRequest.Head.SHA != ""
+	}
+	return false
+}
+
+// readPullRequestEvent reads the pull_request event payload from GITHUB_EVENT_PATH
+func readPullRequestEvent(eventPath string) (pullRequestEvent, error) {
+	var event pullRequestEvent
+	if eventPath == "" {
+		return event, fmt.Errorf("GITHUB_EVENT_PATH environment variable is not set")
+	}
+
+	data, err := os.ReadFile(eventPath)
+	if err != nil {
+		return event, fmt.Errorf("failed to read event payload: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &event); err != nil {
+		return event, fmt.Errorf("failed to parse event payload: %w", err)
+	}
 
-	action.Infof("PDD Action completed successfully")
+	return event, nil
 }
 
 // extractPRNumber extracts the PR number from the GITHUB_REF
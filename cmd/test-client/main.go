@@ -30,7 +30,11 @@ func main() {
 	}
 
 	// Initialize GitHub client
-	client := github.NewClient(token, repoFullName, config)
+	client, err := github.NewClient(token, repoFullName, config)
+	if err != nil {
+		fmt.Printf("Error creating client: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Create test TODO comments
 	comments := []core.TodoComment{
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfigFile is the repository configuration file read from the workspace root
+const DefaultConfigFile = ".pdd.yml"
+
+// FileConfig is the repository configuration read from the configuration file
+type FileConfig struct {
+	// Languages declares additional languages or overrides built-in ones with the same name
+	Languages []Language `yaml:"languages"`
+}
+
+// LoadFileConfig reads the repository configuration file. A missing file yields an empty
+// configuration, unknown keys are rejected to catch typos.
+func LoadFileConfig(path string) (*FileConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &FileConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var config FileConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return &config, nil
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadFileConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	require.NoError(t, os.WriteFile(path, []byte(`languages:
+  - name: Salt
+    extensions: [.sls]
+    line_comments: ["#", ";"]
+  - name: Jinja
+    patterns: ["*.j2"]
+    block_comment_start: "{#"
+    block_comment_end: "#}"
+    nested_comments: true
+`), 0644))
+
+	config, err := LoadFileConfig(path)
+	require.NoError(t, err)
+	require.Len(t, config.Languages, 2)
+	assert.Equal(t, []string{"#", ";"}, config.Languages[0].LineComments)
+	assert.True(t, config.Languages[1].NestedComments)
+}
+
+func TestLoadFileConfigMissingOrEmpty(t *testing.T) {
+	dir := t.TempDir()
+
+	config, err := LoadFileConfig(filepath.Join(dir, DefaultConfigFile))
+	require.NoError(t, err)
+	assert.Empty(t, config.Languages)
+
+	path := filepath.Join(dir, "empty.yml")
+	require.NoError(t, os.WriteFile(path, nil, 0644))
+	config, err = LoadFileConfig(path)
+	require.NoError(t, err)
+	assert.Empty(t, config.Languages)
+}
+
+func TestLoadFileConfigUnknownKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultConfigFile)
+	require.NoError(t, os.WriteFile(path, []byte("languages:\n  - name: X\n    line_coment: \"#\"\n"), 0644))
+
+	_, err := LoadFileConfig(path)
+	assert.ErrorContains(t, err, "line_coment")
+}
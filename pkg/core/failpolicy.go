@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FailPolicy selects when failures to process puzzles fail the run
+type FailPolicy string
+
+const (
+	// FailOnAny fails the run when any puzzle failed
+	FailOnAny FailPolicy = "any"
+	// FailOnAll fails the run only when every puzzle failed
+	FailOnAll FailPolicy = "all"
+	// FailOnNever never fails the run because of failed puzzles
+	FailOnNever FailPolicy = "never"
+)
+
+// ParseFailPolicy validates a failure policy name, FailOnAny when it is empty
+func ParseFailPolicy(value string) (FailPolicy, error) {
+	switch policy := FailPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return FailOnAny, nil
+	case FailOnAny, FailOnAll, FailOnNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown failure policy: %s", value)
+	}
+}
+
+// RunResult summarizes the outcome of processing puzzles in a run
+type RunResult string
+
+const (
+	// ResultSuccess means every puzzle was processed
+	ResultSuccess RunResult = "success"
+	// ResultPartial means some puzzles were processed and some failed
+	ResultPartial RunResult = "partial"
+	// ResultFailure means every puzzle failed
+	ResultFailure RunResult = "failure"
+)
+
+// Outcome returns the result of a run that attempted to process attempted puzzles of
+// which failed did not succeed
+func Outcome(attempted, failed int) RunResult {
+	switch {
+	case failed == 0:
+		return ResultSuccess
+	case failed < attempted:
+		return ResultPartial
+	default:
+		return ResultFailure
+	}
+}
+
+// Fails reports whether the policy fails a run with the given result
+func (p FailPolicy) Fails(result RunResult) bool {
+	switch p {
+	case FailOnNever:
+		return false
+	case FailOnAll:
+		return result == ResultFailure
+	default:
+		return result != ResultSuccess
+	}
+}
@@ -0,0 +1,46 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFailPolicy(t *testing.T) {
+	policy, err := ParseFailPolicy("")
+	require.NoError(t, err)
+	assert.Equal(t, FailOnAny, policy)
+
+	policy, err = ParseFailPolicy(" Never ")
+	require.NoError(t, err)
+	assert.Equal(t, FailOnNever, policy)
+
+	_, err = ParseFailPolicy("some")
+	assert.Error(t, err)
+}
+
+func TestFailPolicy(t *testing.T) {
+	assert.Equal(t, ResultSuccess, Outcome(0, 0))
+	assert.Equal(t, ResultSuccess, Outcome(3, 0))
+	assert.Equal(t, ResultPartial, Outcome(3, 1))
+	assert.Equal(t, ResultFailure, Outcome(3, 3))
+
+	tests := []struct {
+		policy  FailPolicy
+		partial bool
+		failure bool
+	}{
+		{FailOnAny, true, true},
+		{FailOnAll, false, true},
+		{FailOnNever, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			assert.False(t, tt.policy.Fails(ResultSuccess))
+			assert.Equal(t, tt.partial, tt.policy.Fails(ResultPartial))
+			assert.Equal(t, tt.failure, tt.policy.Fails(ResultFailure))
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// parseGoSource parses TODO comments in Go source with go/parser, which finds trailing
+// comments, skips comment markers inside raw strings and records the declaration enclosing
+// each TODO. Sources that do not parse fall back to the line based parser.
+func parseGoSource(filePath string, src []byte, lines []string, terminators Terminators) []TodoComment {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filePath, src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return parseLines(filePath, languageByName("Go"), lines, terminators)
+	}
+
+	collector := todoCollector{
+		filePath:    filePath,
+		terminators: terminators,
+		symbol: func(line int) string {
+			return enclosingSymbol(fset, file, line)
+		},
+	}
+
+	lastLine := 0
+	for _, group := range file.Comments {
+		for _, comment := range group.List {
+			pos := fset.Position(comment.Pos())
+
+			// A comment starts a new run of comment lines after a gap or when it trails code
+			if pos.Line > lastLine+1 || hasCodeBefore(lines, pos) {
+				collector.finish()
+			}
+			lastLine = fset.Position(comment.End()).Line
+
+			if text, ok := strings.CutPrefix(comment.Text, "//"); ok {
+				collector.add(pos.Line, sourceLine(lines, pos.Line), strings.TrimSpace(strings.TrimLeft(text, "/")))
+				continue
+			}
+
+			text := strings.TrimSuffix(strings.TrimPrefix(comment.Text, "/*"), "*/")
+			for i, line := range strings.Split(text, "\n") {
+				collector.add(pos.Line+i, sourceLine(lines, pos.Line+i), cleanBlockLine(line))
+			}
+			// A TODO inside a block comment ends with the block
+			collector.finish()
+		}
+	}
+
+	return collector.result()
+}
+
+// sourceLine returns the line with the given number, or an empty string when it is out of range
+func sourceLine(lines []string, number int) string {
+	if number < 1 || number > len(lines) {
+		return ""
+	}
+	return lines[number-1]
+}
+
+// hasCodeBefore reports whether the line of pos has code before the column of pos
+func hasCodeBefore(lines []string, pos token.Position) bool {
+	if pos.Line < 1 || pos.Line > len(lines) {
+		return false
+	}
+	line := lines[pos.Line-1]
+	return pos.Column-1 <= len(line) && strings.TrimSpace(line[:pos.Column-1]) != ""
+}
+
+// enclosingSymbol returns the name of the top-level declaration, including its doc
+// comment, that contains line, such as (*Client).Update for a method
+func enclosingSymbol(fset *token.FileSet, file *ast.File, line int) string {
+	contains := func(doc *ast.CommentGroup, node ast.Node) bool {
+		start := node.Pos()
+		if doc != nil {
+			start = doc.Pos()
+		}
+		return fset.Position(start).Line <= line && line <= fset.Position(node.End()).Line
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if contains(decl.Doc, decl) {
+				return funcSymbol(decl)
+			}
+		case *ast.GenDecl:
+			if !contains(decl.Doc, decl) {
+				continue
+			}
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if contains(spec.Doc, spec) || len(decl.Specs) == 1 {
+						return spec.Name.Name
+					}
+				case *ast.ValueSpec:
+					if contains(spec.Doc, spec) || len(decl.Specs) == 1 {
+						return spec.Names[0].Name
+					}
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// funcSymbol returns the name of a function, qualified by its receiver type for methods
+func funcSymbol(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return decl.Name.Name
+	}
+
+	recv := decl.Recv.List[0].Type
+	pointer := false
+	if star, ok := recv.(*ast.StarExpr); ok {
+		recv, pointer = star.X, true
+	}
+
+	// Drop type parameters of generic receivers
+	switch expr := recv.(type) {
+	case *ast.IndexExpr:
+		recv = expr.X
+	case *ast.IndexListExpr:
+		recv = expr.X
+	}
+
+	name := "?"
+	if ident, ok := recv.(*ast.Ident); ok {
+		name = ident.Name
+	}
+	if pointer {
+		return "(*" + name + ")." + decl.Name.Name
+	}
+	return name + "." + decl.Name.Name
+}
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testGoSource = `package github
+
+// TODO: Split the client
+// Labels: refactoring
+type Client struct {
+	token string // TODO: Support app tokens
+}
+
+const usage = ` + "`" + `
+// TODO: Not a comment inside a raw string
+` + "`" + `
+
+// UpdateCommentInFile updates the comment
+func (c *Client) UpdateCommentInFile() error {
+	/* TODO: Retry on conflicts
+	   with backoff */
+	return nil
+}
+
+func (l List[T]) Len() int {
+	return len(l) // TODO: Cache the length
+	// Issue: https://github.com/o/r/issues/3
+}
+`
+
+func TestParseGoSource(t *testing.T) {
+	comments := parseGoSource("pkg/github/client.go", []byte(testGoSource), strings.Split(testGoSource, "\n"), 0)
+	require.Len(t, comments, 4)
+
+	assert.Equal(t, "Split the client", comments[0].Title)
+	assert.Equal(t, []string{"refactoring"}, comments[0].Labels)
+	assert.Equal(t, "Client", comments[0].Symbol)
+
+	// Trailing comments are found and not merged with the comment above
+	assert.Equal(t, "Support app tokens", comments[1].Title)
+	assert.Equal(t, 6, comments[1].LineNumber)
+	assert.Empty(t, comments[1].Description)
+
+	assert.Equal(t, "Retry on conflicts", comments[2].Title)
+	assert.Equal(t, []string{"with backoff"}, comments[2].Description)
+	assert.Equal(t, "(*Client).UpdateCommentInFile", comments[2].Symbol)
+	assert.Equal(t, "pkg/github.(*Client).UpdateCommentInFile", comments[2].QualifiedSymbol())
+
+	assert.Equal(t, "Cache the length", comments[3].Title)
+	assert.Equal(t, "List.Len", comments[3].Symbol)
+	assert.Equal(t, "https://github.com/o/r/issues/3", comments[3].IssueURL)
+}
+
+func TestParseGoSourceFallback(t *testing.T) {
+	src := "package main\n\n// TODO: Finish this\nfunc main( {\n"
+
+	comments := parseGoSource("main.go", []byte(src), strings.Split(src, "\n"), 0)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Finish this", comments[0].Title)
+	assert.Empty(t, comments[0].Symbol)
+}
+
+func TestScanDirectoryGoSymbols(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "client.go"), []byte(testGoSource), 0o600))
+
+	comments, err := ScanDirectory(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, comments, 4)
+	assert.Equal(t, "(*Client).UpdateCommentInFile", comments[2].Symbol)
+}
+
+func TestInsertIssueLineTrailingComment(t *testing.T) {
+	content := "func f() {\n\tx := 1 // TODO: Use a constant\n}\n"
+	comment := TodoComment{FilePath: "f.go", LineNumber: 2, IssueURL: "https://github.com/o/r/issues/1"}
+
+	got, changed, err := InsertIssueLine([]byte(content), comment)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "func f() {\n\tx := 1 // TODO: Use a constant\n\t// Issue: https://github.com/o/r/issues/1\n}\n", string(got))
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultServerURL is the URL of github.com
+const DefaultServerURL = "https://github.com"
+
+// DefaultAPIURL is the URL of the github.com REST API
+const DefaultAPIURL = "https://api.github.com"
+
+// issueReferenceRegex matches issue references such as #123 and owner/repo#123
+var issueReferenceRegex = regexp.MustCompile(`^(?:([\w.-]+)/([\w.-]+))?#(\d+)$`)
+
+// IssueRef identifies an issue in a repository
+type IssueRef struct {
+	Owner  string
+	Repo   string
+	Number int
+}
+
+// String returns the fully qualified owner/repo#number form of the reference
+func (r IssueRef) String() string {
+	return fmt.Sprintf("%s/%s#%d", r.Owner, r.Repo, r.Number)
+}
+
+// URL returns the web URL of the issue on the given server
+func (r IssueRef) URL(serverURL string) string {
+	return fmt.Sprintf("%s/%s/%s/issues/%d", strings.TrimRight(serverOrDefault(serverURL), "/"), r.Owner, r.Repo, r.Number)
+}
+
+// ParseIssueReference parses an issue reference such as #123, resolved against the
+// repository owner/repo, or owner/repo#123
+func ParseIssueReference(ref, owner, repo string) (IssueRef, bool) {
+	match := issueReferenceRegex.FindStringSubmatch(strings.TrimSpace(ref))
+	if match == nil {
+		return IssueRef{}, false
+	}
+
+	number, err := strconv.Atoi(match[3])
+	if err != nil || number <= 0 {
+		return IssueRef{}, false
+	}
+
+	if match[1] != "" {
+		owner, repo = match[1], match[2]
+	}
+	return IssueRef{Owner: owner, Repo: repo, Number: number}, true
+}
+
+// ParseIssueURL recognizes a web URL of an issue or pull request hosted on the given server,
+// e.g. https://github.example.com/owner/repo/issues/42
+func ParseIssueURL(serverURL, issueURL string) (IssueRef, bool) {
+	server, err := url.Parse(serverOrDefault(serverURL))
+	if err != nil {
+		return IssueRef{}, false
+	}
+
+	u, err := url.Parse(strings.TrimSpace(issueURL))
+	if err != nil || !strings.EqualFold(u.Host, server.Host) {
+		return IssueRef{}, false
+	}
+
+	path := strings.TrimPrefix(u.Path, strings.TrimRight(server.Path, "/"))
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	if len(parts) != 4 || (parts[2] != "issues" && parts[2] != "pull") {
+		return IssueRef{}, false
+	}
+
+	number, err := strconv.Atoi(parts[3])
+	if err != nil || number <= 0 {
+		return IssueRef{}, false
+	}
+
+	return IssueRef{Owner: parts[0], Repo: parts[1], Number: number}, true
+}
+
+// ServerURLFromAPIURL derives the web server URL from a REST API URL,
+// e.g. https://github.example.com/api/v3 becomes https://github.example.com
+func ServerURLFromAPIURL(apiURL string) string {
+	apiURL = strings.TrimRight(apiURL, "/")
+	if apiURL == "" || apiURL == DefaultAPIURL {
+		return DefaultServerURL
+	}
+	return strings.TrimSuffix(apiURL, "/api/v3")
+}
+
+// serverOrDefault returns the server URL or github.com if it's empty
+func serverOrDefault(serverURL string) string {
+	if serverURL == "" {
+		return DefaultServerURL
+	}
+	return serverURL
+}
@@ -0,0 +1,83 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseIssueURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		serverURL string
+		issueURL  string
+		want      IssueRef
+		wantOK    bool
+	}{
+		{
+			name:     "github.com issue",
+			issueURL: "https://github.com/ksysoev/pdd-action/issues/42",
+			want:     IssueRef{Owner: "ksysoev", Repo: "pdd-action", Number: 42},
+			wantOK:   true,
+		},
+		{
+			name:      "enterprise issue",
+			serverURL: "https://github.example.com",
+			issueURL:  "https://github.example.com/team/service/issues/7",
+			want:      IssueRef{Owner: "team", Repo: "service", Number: 7},
+			wantOK:    true,
+		},
+		{
+			name:      "enterprise server with path prefix",
+			serverURL: "https://example.com/git/",
+			issueURL:  "https://example.com/git/team/service/pull/3",
+			want:      IssueRef{Owner: "team", Repo: "service", Number: 3},
+			wantOK:    true,
+		},
+		{
+			name:      "issue on another host",
+			serverURL: "https://github.example.com",
+			issueURL:  "https://github.com/ksysoev/pdd-action/issues/42",
+		},
+		{
+			name:     "not an issue URL",
+			issueURL: "https://github.com/ksysoev/pdd-action/blob/main/README.md",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseIssueURL(tt.serverURL, tt.issueURL)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestServerURLFromAPIURL(t *testing.T) {
+	assert.Equal(t, DefaultServerURL, ServerURLFromAPIURL(""))
+	assert.Equal(t, DefaultServerURL, ServerURLFromAPIURL("https://api.github.com/"))
+	assert.Equal(t, "https://github.example.com", ServerURLFromAPIURL("https://github.example.com/api/v3"))
+}
+
+func TestIssueRefURL(t *testing.T) {
+	ref := IssueRef{Owner: "team", Repo: "service", Number: 7}
+	assert.Equal(t, "https://github.example.com/team/service/issues/7", ref.URL("https://github.example.com/"))
+	assert.Equal(t, "https://github.com/team/service/issues/7", ref.URL(""))
+	assert.Equal(t, "team/service#7", ref.String())
+}
+
+func TestParseIssueReference(t *testing.T) {
+	ref, ok := ParseIssueReference("#123", "o", "r")
+	assert.True(t, ok)
+	assert.Equal(t, IssueRef{Owner: "o", Repo: "r", Number: 123}, ref)
+
+	ref, ok = ParseIssueReference("org/tools.go#7", "o", "r")
+	assert.True(t, ok)
+	assert.Equal(t, IssueRef{Owner: "org", Repo: "tools.go", Number: 7}, ref)
+
+	for _, invalid := range []string{"alice", "#0", "#", "org#1", "o/r/x#1"} {
+		_, ok = ParseIssueReference(invalid, "o", "r")
+		assert.False(t, ok, invalid)
+	}
+}
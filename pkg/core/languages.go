@@ -0,0 +1,422 @@
+package core
+
+import (
+	_ "embed"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// modelineLines is how many lines at the start and end of a file are searched for modelines
+const modelineLines = 5
+
+// Language defines how a programming language is detected and its comment styles
+type Language struct {
+	Name string `yaml:"name"`
+	// Extensions are matched against the file extension, including the leading dot
+	Extensions []string `yaml:"extensions"`
+	// Filenames are matched against the exact base name of the file
+	Filenames []string `yaml:"filenames"`
+	// Patterns are glob patterns matched against the base name of the file
+	Patterns []string `yaml:"patterns"`
+	// Interpreters are matched against the interpreter of the shebang line
+	Interpreters []string `yaml:"interpreters"`
+	// Aliases are matched against the file type named in Vim and Emacs modelines
+	Aliases []string `yaml:"aliases"`
+
+	// LineComment is the prefix of single line comments, also used for new comment lines
+	LineComment string `yaml:"line_comment"`
+	// LineComments are additional single line comment prefixes such as ";" next to "#"
+	LineComments      []string `yaml:"line_comments"`
+	BlockCommentStart string   `yaml:"block_comment_start"`
+	BlockCommentEnd   string   `yaml:"block_comment_end"`
+	// BlockComments are additional block comment delimiters such as "{{!--" and "--}}"
+	BlockComments []BlockComment `yaml:"block_comments"`
+	// NestedComments is set when block comments can contain other block comments
+	NestedComments bool `yaml:"nested_comments"`
+	// Regions are embedded sections, such as <script> in a Vue component, whose lines use the
+	// comment syntax of another language
+	Regions []Region `yaml:"regions"`
+}
+
+// Region is an embedded section of a file written in another language
+type Region struct {
+	// Start and End are regular expressions matching the delimiters of the section
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// Language is the name of the language of the section, overridden by a lang attribute
+	// such as <script lang="ts"> on the opening line
+	Language string `yaml:"language"`
+	// Initial is set when files start inside the section, such as the HTML before the
+	// first <?php tag of a PHP template
+	Initial bool `yaml:"initial"`
+}
+
+// BlockComment is a pair of block comment delimiters
+type BlockComment struct {
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+}
+
+// blockComments returns all block comment delimiters of the language, longest start first
+// so that a delimiter such as "{{!--" is matched before "{{!"
+func (l *Language) blockComments() []BlockComment {
+	var blocks []BlockComment
+	if l.BlockCommentStart != "" {
+		blocks = append(blocks, BlockComment{Start: l.BlockCommentStart, End: l.BlockCommentEnd})
+	}
+	for _, block := range l.BlockComments {
+		if block.Start != "" && !slices.Contains(blocks, block) {
+			blocks = append(blocks, block)
+		}
+	}
+	slices.SortStableFunc(blocks, func(a, b BlockComment) int { return len(b.Start) - len(a.Start) })
+	return blocks
+}
+
+// lineCommentPrefixes returns all line comment prefixes of the language, longest first so
+// that a prefix such as "//" is matched before "/"
+func (l *Language) lineCommentPrefixes() []string {
+	var prefixes []string
+	for _, prefix := range append([]string{l.LineComment}, l.LineComments...) {
+		if prefix != "" && !slices.Contains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	slices.SortStableFunc(prefixes, func(a, b string) int { return len(b) - len(a) })
+	return prefixes
+}
+
+// lineCommentPrefix returns the prefix used for new line comments, empty for languages with only block comments
+func (l *Language) lineCommentPrefix() string {
+	if l.LineComment != "" {
+		return l.LineComment
+	}
+	for _, prefix := range l.LineComments {
+		if prefix != "" {
+			return prefix
+		}
+	}
+	return ""
+}
+
+//go:embed languages.yml
+var languagesData []byte
+
+var supportedLanguages = mustLoadLanguages(languagesData)
+
+var (
+	vimModelineRegex   = regexp.MustCompile(`(?:^|\s)(?:vim?|ex):(?:.*?[\s:])?(?:ft|filetype|syntax|syn)=([\w+#.-]+)`)
+	emacsModelineRegex = regexp.MustCompile(`-\*-\s*(.*?)\s*-\*-`)
+	emacsModeRegex     = regexp.MustCompile(`(?i)(?:^|;)\s*mode:\s*([^;\s]+)`)
+)
+
+// LoadLanguages parses a list of language definitions in YAML
+func LoadLanguages(data []byte) ([]Language, error) {
+	var languages []Language
+	if err := yaml.Unmarshal(data, &languages); err != nil {
+		return nil, fmt.Errorf("failed to parse languages: %w", err)
+	}
+
+	for i := range languages {
+		if err := validateLanguage(&languages[i], i); err != nil {
+			return nil, err
+		}
+	}
+	if err := validateRegions(languages); err != nil {
+		return nil, err
+	}
+
+	return languages, nil
+}
+
+// validateRegions checks that the languages of all regions are defined
+func validateRegions(languages []Language) error {
+	for _, lang := range languages {
+		for _, region := range lang.Regions {
+			if !slices.ContainsFunc(languages, func(l Language) bool { return strings.EqualFold(l.Name, region.Language) }) {
+				return fmt.Errorf("language %s has a region in unknown language %s", lang.Name, region.Language)
+			}
+		}
+	}
+	return nil
+}
+
+// validateLanguage checks that a language definition has a name and a usable comment syntax
+func validateLanguage(lang *Language, index int) error {
+	if lang.Name == "" {
+		return fmt.Errorf("language %d has no name", index+1)
+	}
+	if (lang.BlockCommentStart == "") != (lang.BlockCommentEnd == "") {
+		return fmt.Errorf("language %s must define both block comment delimiters", lang.Name)
+	}
+	for _, block := range lang.BlockComments {
+		if block.Start == "" || block.End == "" {
+			return fmt.Errorf("language %s must define both block comment delimiters", lang.Name)
+		}
+	}
+	if len(lang.lineCommentPrefixes()) == 0 && len(lang.blockComments()) == 0 {
+		return fmt.Errorf("language %s has no comment syntax", lang.Name)
+	}
+	for _, pattern := range lang.Patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("language %s has invalid pattern %q: %w", lang.Name, pattern, err)
+		}
+	}
+	for _, region := range lang.Regions {
+		if region.Start == "" || region.End == "" || region.Language == "" {
+			return fmt.Errorf("language %s has a region without start, end or language", lang.Name)
+		}
+		for _, expr := range []string{region.Start, region.End} {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Errorf("language %s has invalid region delimiter %q: %w", lang.Name, expr, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MergeLanguages merges user defined languages into base. A custom language with the name
+// of a base language replaces it, and file names, patterns and extensions claimed by custom
+// languages are removed from the remaining base languages. Custom languages claiming the
+// same file name, pattern or extension are ambiguous and rejected.
+func MergeLanguages(base, custom []Language) ([]Language, error) {
+	claims := make(map[string]string)
+	for i := range custom {
+		lang := &custom[i]
+		if err := validateLanguage(lang, i); err != nil {
+			return nil, err
+		}
+
+		for _, key := range languageClaims(lang) {
+			if other, ok := claims[key]; ok && other != lang.Name {
+				return nil, fmt.Errorf("languages %s and %s both claim %s", other, lang.Name, key)
+			}
+			claims[key] = lang.Name
+		}
+	}
+
+	merged := make([]Language, 0, len(base)+len(custom))
+	merged = append(merged, custom...)
+
+	for _, lang := range base {
+		if slices.ContainsFunc(custom, func(c Language) bool { return strings.EqualFold(c.Name, lang.Name) }) {
+			continue
+		}
+
+		lang.Extensions = unclaimed(lang.Extensions, "extension ", claims)
+		lang.Filenames = unclaimed(lang.Filenames, "file name ", claims)
+		lang.Patterns = unclaimed(lang.Patterns, "pattern ", claims)
+		merged = append(merged, lang)
+	}
+
+	if err := validateRegions(merged); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// RegisterLanguages merges user defined languages into the registry used to detect file languages
+func RegisterLanguages(custom []Language) error {
+	merged, err := MergeLanguages(supportedLanguages, custom)
+	if err != nil {
+		return err
+	}
+	supportedLanguages = merged
+	return nil
+}
+
+// languageClaims returns the keys of the file names, patterns and extensions a language claims
+func languageClaims(lang *Language) []string {
+	var keys []string
+	for _, ext := range lang.Extensions {
+		keys = append(keys, "extension "+ext)
+	}
+	for _, name := range lang.Filenames {
+		keys = append(keys, "file name "+name)
+	}
+	for _, pattern := range lang.Patterns {
+		keys = append(keys, "pattern "+pattern)
+	}
+	return keys
+}
+
+// unclaimed returns the values whose claim key is not in claims
+func unclaimed(values []string, kind string, claims map[string]string) []string {
+	var result []string
+	for _, v := range values {
+		if _, ok := claims[kind+v]; !ok {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+// mustLoadLanguages parses the embedded language definitions
+func mustLoadLanguages(data []byte) []Language {
+	languages, err := LoadLanguages(data)
+	if err != nil {
+		panic(err)
+	}
+	return languages
+}
+
+// GetLanguageForFile determines the language of a file based on its name, matching the
+// exact file name, glob patterns and the extension in that order
+func GetLanguageForFile(filename string) *Language {
+	base := filepath.Base(filename)
+
+	if lang := findLanguage(func(lang *Language) bool { return slices.Contains(lang.Filenames, base) }); lang != nil {
+		return lang
+	}
+
+	lang := findLanguage(func(lang *Language) bool {
+		for _, pattern := range lang.Patterns {
+			if ok, _ := path.Match(pattern, base); ok {
+				return true
+			}
+		}
+		return false
+	})
+	if lang != nil {
+		return lang
+	}
+
+	ext := filepath.Ext(base)
+	if ext == "" {
+		return nil
+	}
+	if lang := findLanguage(func(lang *Language) bool { return slices.Contains(lang.Extensions, ext) }); lang != nil {
+		return lang
+	}
+
+	// Fall back to a case insensitive match for extensions such as .PY
+	return findLanguage(func(lang *Language) bool {
+		for _, langExt := range lang.Extensions {
+			if strings.EqualFold(langExt, ext) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// DetectLanguage determines the language of a file from its name and decoded lines. A Vim
+// or Emacs modeline takes precedence over the file name, and the shebang line is used for
+// files whose name does not identify the language.
+func DetectLanguage(filename string, lines []string) *Language {
+	if lang := languageFromModeline(lines); lang != nil {
+		return lang
+	}
+	if lang := GetLanguageForFile(filename); lang != nil {
+		return lang
+	}
+	if len(lines) > 0 {
+		return languageFromShebang(lines[0])
+	}
+	return nil
+}
+
+// languageFromShebang returns the language of the interpreter named in a shebang line
+func languageFromShebang(line string) *Language {
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return nil
+	}
+
+	interpreter := path.Base(fields[0])
+	if interpreter == "env" {
+		// Skip env options such as -S and variable assignments
+		interpreter = ""
+		for _, field := range fields[1:] {
+			if strings.HasPrefix(field, "-") || strings.Contains(field, "=") {
+				continue
+			}
+			interpreter = path.Base(field)
+			break
+		}
+	}
+	if interpreter == "" {
+		return nil
+	}
+
+	if lang := findLanguage(func(lang *Language) bool { return slices.Contains(lang.Interpreters, interpreter) }); lang != nil {
+		return lang
+	}
+
+	// Match versioned interpreters such as python3.12 or ruby2.7
+	unversioned := strings.TrimRight(interpreter, "0123456789.")
+	return findLanguage(func(lang *Language) bool { return slices.Contains(lang.Interpreters, unversioned) })
+}
+
+// languageFromModeline returns the language named in a Vim or Emacs modeline found in the
+// first or last lines of a file
+func languageFromModeline(lines []string) *Language {
+	candidates := lines
+	if len(lines) > 2*modelineLines {
+		candidates = append(append([]string{}, lines[:modelineLines]...), lines[len(lines)-modelineLines:]...)
+	}
+
+	for _, line := range candidates {
+		if name := modelineFileType(line); name != "" {
+			if lang := languageByAlias(name); lang != nil {
+				return lang
+			}
+		}
+	}
+
+	return nil
+}
+
+// modelineFileType extracts the file type from a Vim modeline such as "vim: set ft=cpp:"
+// or an Emacs modeline such as "-*- mode: c++ -*-" or "-*- c++ -*-"
+func modelineFileType(line string) string {
+	if match := vimModelineRegex.FindStringSubmatch(line); match != nil {
+		return match[1]
+	}
+
+	match := emacsModelineRegex.FindStringSubmatch(line)
+	if match == nil {
+		return ""
+	}
+	if mode := emacsModeRegex.FindStringSubmatch(match[1]); mode != nil {
+		return mode[1]
+	}
+	if !strings.ContainsAny(match[1], ":;") {
+		return match[1]
+	}
+	return ""
+}
+
+// languageByName returns the supported language with the given name
+func languageByName(name string) *Language {
+	return findLanguage(func(lang *Language) bool { return strings.EqualFold(lang.Name, name) })
+}
+
+// languageByAlias returns the supported language with the given alias, as used in modelines
+func languageByAlias(alias string) *Language {
+	return findLanguage(func(lang *Language) bool {
+		return slices.ContainsFunc(lang.Aliases, func(a string) bool { return strings.EqualFold(a, alias) })
+	})
+}
+
+// findLanguage returns a copy of the first supported language matching the predicate
+func findLanguage(match func(lang *Language) bool) *Language {
+	for i := range supportedLanguages {
+		if match(&supportedLanguages[i]) {
+			lang := supportedLanguages[i]
+			return &lang
+		}
+	}
+	return nil
+}
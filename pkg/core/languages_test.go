@@ -0,0 +1,210 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLanguageForFileByName(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "Dockerfile", want: "Dockerfile"},
+		{filename: "build/Dockerfile.prod", want: "Dockerfile"},
+		{filename: "api.Dockerfile", want: "Dockerfile"},
+		{filename: "Makefile", want: "Makefile"},
+		{filename: "rules.mk", want: "Makefile"},
+		{filename: "ci/Jenkinsfile", want: "Groovy"},
+		{filename: "main.tf", want: "HCL"},
+		{filename: "config.yaml", want: "YAML"},
+		{filename: "pyproject.toml", want: "TOML"},
+		{filename: "api.proto", want: "Protocol Buffers"},
+		{filename: "schema.graphql", want: "GraphQL"},
+		{filename: "main.dart", want: "Dart"},
+		{filename: "build.zig", want: "Zig"},
+		{filename: "run.jl", want: "Julia"},
+		{filename: "core.clj", want: "Clojure"},
+		{filename: "init.el", want: "Lisp"},
+		{filename: "solver.f90", want: "Fortran"},
+		{filename: "Module.vb", want: "Visual Basic"},
+		{filename: "boot.asm", want: "Assembly"},
+		{filename: "app.nim", want: "Nim"},
+		{filename: "main.ml", want: "OCaml"},
+		{filename: "SCRIPT.PY", want: "Python"},
+		{filename: "README", want: ""},
+		{filename: "notes.xyz", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			lang := GetLanguageForFile(tt.filename)
+			if tt.want == "" {
+				assert.Nil(t, lang)
+				return
+			}
+			require.NotNil(t, lang)
+			assert.Equal(t, tt.want, lang.Name)
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		lines    []string
+		want     string
+	}{
+		{name: "env shebang", filename: "bin/deploy", lines: []string{"#!/usr/bin/env python"}, want: "Python"},
+		{name: "env shebang with options", filename: "run", lines: []string{"#!/usr/bin/env -S deno run --allow-net"}, want: "TypeScript"},
+		{name: "direct shebang", filename: "setup", lines: []string{"#!/bin/bash -e"}, want: "Shell"},
+		{name: "versioned interpreter", filename: "tool", lines: []string{"#!/usr/bin/python3.12"}, want: "Python"},
+		{name: "unknown interpreter", filename: "tool", lines: []string{"#!/usr/bin/env unknown"}, want: ""},
+		{name: "vim modeline", filename: "util.h", lines: []string{"// vim: set ft=cpp:", "class A {};"}, want: "C++"},
+		{name: "vim modeline without set", filename: "util.h", lines: []string{"/* vi:ft=cpp */"}, want: "C++"},
+		{name: "emacs mode", filename: "util.h", lines: []string{"// -*- mode: c++; indent-tabs-mode: nil -*-"}, want: "C++"},
+		{name: "emacs short form", filename: "script", lines: []string{"#!/bin/sh", "# -*- ruby -*-"}, want: "Ruby"},
+		{name: "modeline at end", filename: "config", lines: []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "# vim: ft=yaml"}, want: "YAML"},
+		{name: "name without modeline", filename: "util.h", lines: []string{"int f(void);"}, want: "C"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lang := DetectLanguage(tt.filename, tt.lines)
+			if tt.want == "" {
+				assert.Nil(t, lang)
+				return
+			}
+			require.NotNil(t, lang)
+			assert.Equal(t, tt.want, lang.Name)
+		})
+	}
+}
+
+func TestLoadLanguagesValidation(t *testing.T) {
+	_, err := LoadLanguages([]byte(`- extensions: [.x]`))
+	assert.ErrorContains(t, err, "no name")
+
+	_, err = LoadLanguages([]byte(`- name: X
+  extensions: [.x]`))
+	assert.ErrorContains(t, err, "no comment syntax")
+
+	_, err = LoadLanguages([]byte(`- name: X
+  block_comment_start: "/*"`))
+	assert.ErrorContains(t, err, "both block comment delimiters")
+
+	_, err = LoadLanguages([]byte(`- name: X
+  line_comment: "#"
+  patterns: ["[x"]`))
+	assert.ErrorContains(t, err, "invalid pattern")
+}
+
+func TestScanDirectoryDetectsScripts(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"bin/deploy":     "#!/usr/bin/env bash\n# TODO: Deploy script task\n",
+		"Dockerfile":     "FROM alpine\n# TODO: Dockerfile task\n",
+		"LICENSE":        "TODO: not a comment\n",
+		"config.json":    "{\"todo\": \"// TODO: JSON\"}\n",
+		"include/a.h":    "// vim: set ft=cpp:\n// TODO: Header task\n",
+		"tools/Makefile": "build:\n# TODO: Makefile task\n",
+	})
+
+	comments, err := ScanDirectory(dir, nil)
+	require.NoError(t, err)
+
+	var got []string
+	for _, comment := range comments {
+		rel, err := filepath.Rel(dir, comment.FilePath)
+		require.NoError(t, err)
+		got = append(got, filepath.ToSlash(rel)+" "+comment.Title)
+	}
+	assert.Equal(t, []string{
+		"Dockerfile Dockerfile task",
+		"bin/deploy Deploy script task",
+		"include/a.h Header task",
+		"tools/Makefile Makefile task",
+	}, got)
+}
+
+func TestMergeLanguages(t *testing.T) {
+	base := []Language{
+		{Name: "C", Extensions: []string{".c", ".h"}, LineComment: "//"},
+		{Name: "Shell", Extensions: []string{".sh"}, LineComment: "#"},
+	}
+
+	merged, err := MergeLanguages(base, []Language{
+		{Name: "shell", Extensions: []string{".sh", ".bash"}, LineComments: []string{"#", ";"}},
+		{Name: "C++", Extensions: []string{".h"}, LineComment: "//"},
+		{Name: "Salt", Extensions: []string{".sls"}, LineComment: "#"},
+	})
+	require.NoError(t, err)
+
+	var names []string
+	for _, lang := range merged {
+		names = append(names, lang.Name)
+	}
+	assert.Equal(t, []string{"shell", "C++", "Salt", "C"}, names, "custom languages replace built-in ones with the same name")
+	assert.Equal(t, []string{".c"}, merged[3].Extensions, "extensions claimed by custom languages are removed from built-in ones")
+}
+
+func TestMergeLanguagesAmbiguous(t *testing.T) {
+	_, err := MergeLanguages(nil, []Language{
+		{Name: "Salt", Extensions: []string{".sls"}, LineComment: "#"},
+		{Name: "Other", Extensions: []string{".sls"}, LineComment: ";"},
+	})
+	assert.ErrorContains(t, err, "languages Salt and Other both claim extension .sls")
+
+	_, err = MergeLanguages(nil, []Language{{Name: "Bad", Extensions: []string{".x"}}})
+	assert.ErrorContains(t, err, "no comment syntax")
+}
+
+func TestRegisterLanguages(t *testing.T) {
+	original := supportedLanguages
+	t.Cleanup(func() { supportedLanguages = original })
+
+	require.Nil(t, GetLanguageForFile("state.sls"))
+
+	require.NoError(t, RegisterLanguages([]Language{
+		{Name: "Salt", Extensions: []string{".sls"}, LineComments: []string{"#", ";"}},
+	}))
+
+	lang := GetLanguageForFile("state.sls")
+	require.NotNil(t, lang)
+	assert.Equal(t, "Salt", lang.Name)
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"state.sls": "# TODO: Hash task\n# Details\nkey: value\n; TODO: Semicolon task\n;; More details\n",
+	})
+	comments, err := ScanDirectory(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, "Hash task", comments[0].Title)
+	assert.Equal(t, "Semicolon task", comments[1].Title)
+	assert.Equal(t, []string{"More details"}, comments[1].Description)
+}
+
+func TestMergeLanguagesUnknownRegionLanguage(t *testing.T) {
+	_, err := MergeLanguages(supportedLanguages, []Language{{
+		Name:              "Component",
+		Extensions:        []string{".cmp"},
+		BlockCommentStart: "<!--",
+		BlockCommentEnd:   "-->",
+		Regions:           []Region{{Start: `<code>`, End: `</code>`, Language: "Missing"}},
+	}})
+	assert.ErrorContains(t, err, "unknown language Missing")
+
+	_, err = MergeLanguages(supportedLanguages, []Language{{
+		Name:              "Component",
+		Extensions:        []string{".cmp"},
+		BlockCommentStart: "<!--",
+		BlockCommentEnd:   "-->",
+		Regions:           []Region{{Start: `(`, End: `)`, Language: "Go"}},
+	}})
+	assert.ErrorContains(t, err, "invalid region delimiter")
+}
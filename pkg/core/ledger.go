@@ -0,0 +1,320 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LedgerVersion is the version of the ledger file schema
+const LedgerVersion = 1
+
+// DefaultLedgerPath is the default location of the ledger file in the repository
+const DefaultLedgerPath = ".pdd/ledger.json"
+
+// LedgerStatus represents the state of a puzzle tracked in the ledger
+type LedgerStatus string
+
+const (
+	// LedgerStatusOpen means the puzzle is still present in the code
+	LedgerStatusOpen LedgerStatus = "open"
+	// LedgerStatusRemoved means the puzzle is no longer present in the code
+	LedgerStatusRemoved LedgerStatus = "removed"
+	// LedgerStatusClosed means the issue of the puzzle was closed
+	LedgerStatusClosed LedgerStatus = "closed"
+)
+
+// LedgerEntry maps a puzzle fingerprint to the issue created for it
+type LedgerEntry struct {
+	Fingerprint string       `json:"fingerprint"`
+	IssueNumber int          `json:"issue_number"`
+	IssueURL    string       `json:"issue_url"`
+	FilePath    string       `json:"file"`
+	Cell        int          `json:"cell,omitempty"`
+	LineNumber  int          `json:"line"`
+	Title       string       `json:"title"`
+	CreatedAt   time.Time    `json:"created_at"`
+	Status      LedgerStatus `json:"status"`
+}
+
+// Ledger is a machine-readable record of the puzzles processed by the action
+type Ledger struct {
+	Version int           `json:"version"`
+	Entries []LedgerEntry `json:"entries"`
+	// Retries are the write-backs that failed in the last run, retried first by the next one
+	Retries RetryQueue `json:"retries,omitempty"`
+}
+
+// ReconcileResult describes the changes made while reconciling the ledger with scanned comments
+type ReconcileResult struct {
+	// Comments are the scanned comments with issue URLs restored from the ledger
+	Comments []TodoComment
+	// Restored are the comments whose Issue: line was missing in the code but found in the ledger
+	Restored []TodoComment
+	// Adopted is the number of processed comments added to the ledger
+	Adopted int
+	// Removed is the number of ledger entries whose puzzle is no longer in the code
+	Removed int
+}
+
+// Fingerprint returns a stable identifier of the puzzle based on its file and title,
+// so it survives line moves and edits of the description. Puzzles sharing a title in the
+// same file are told apart by their occurrence, the first one keeps the fingerprint of a
+// puzzle with a unique title.
+func (t TodoComment) Fingerprint() string {
+	key := filepath.ToSlash(t.FilePath) + "\x00" + t.normalizedTitle()
+	if t.Occurrence > 0 {
+		key += "\x00" + strconv.Itoa(t.Occurrence)
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// normalizedTitle returns the title in lower case with runs of whitespace collapsed
+func (t TodoComment) normalizedTitle() string {
+	return strings.ToLower(strings.Join(strings.Fields(t.Title), " "))
+}
+
+// sameTitle reports whether t and other are puzzles with the same title in the same file
+func (t TodoComment) sameTitle(other TodoComment) bool {
+	return filepath.ToSlash(t.FilePath) == filepath.ToSlash(other.FilePath) && t.normalizedTitle() == other.normalizedTitle()
+}
+
+// numberOccurrences sets the occurrence of every comment of a file among the comments
+// with the same title, in the order they appear
+func numberOccurrences(comments []TodoComment) {
+	seen := make(map[string]int, len(comments))
+	for i := range comments {
+		title := comments[i].normalizedTitle()
+		comments[i].Occurrence = seen[title]
+		seen[title]++
+	}
+}
+
+// NewLedger creates an empty ledger
+func NewLedger() *Ledger {
+	return &Ledger{Version: LedgerVersion}
+}
+
+// Lookup returns the ledger entry for the given fingerprint
+func (l *Ledger) Lookup(fingerprint string) (*LedgerEntry, bool) {
+	for i := range l.Entries {
+		if l.Entries[i].Fingerprint == fingerprint {
+			return &l.Entries[i], true
+		}
+	}
+	return nil, false
+}
+
+// Record adds or updates the ledger entry for a processed comment
+func (l *Ledger) Record(comment TodoComment, createdAt time.Time) {
+	fingerprint := comment.Fingerprint()
+	entry, ok := l.Lookup(fingerprint)
+	if !ok {
+		l.Entries = append(l.Entries, LedgerEntry{Fingerprint: fingerprint, CreatedAt: createdAt})
+		entry = &l.Entries[len(l.Entries)-1]
+	}
+
+	entry.IssueURL = comment.IssueURL
+	entry.IssueNumber = IssueNumberFromURL(comment.IssueURL)
+	entry.FilePath = comment.FilePath
+	entry.Cell = comment.Cell
+	entry.LineNumber = comment.LineNumber
+	entry.Title = comment.Title
+	entry.Status = LedgerStatusOpen
+}
+
+// Forget removes the ledger entry for the given fingerprint, so the puzzle gets a new issue
+func (l *Ledger) Forget(fingerprint string) {
+	l.Entries = slices.DeleteFunc(l.Entries, func(e LedgerEntry) bool { return e.Fingerprint == fingerprint })
+}
+
+// Reconcile matches scanned comments against the ledger. Entries are updated with the
+// current location of their puzzle, comments that lost their Issue: line get the issue URL
+// back from the ledger, processed comments unknown to the ledger are adopted and entries
+// whose puzzle disappeared from the code are marked as removed. An issue URL still
+// referenced by another puzzle in the code is never restored, so a new puzzle doesn't
+// take over the issue of an existing one.
+func (l *Ledger) Reconcile(comments []TodoComment, now time.Time) ReconcileResult {
+	var result ReconcileResult
+	seen := make(map[string]bool, len(comments))
+
+	referenced := make(map[string]bool, len(comments))
+	for _, comment := range comments {
+		if comment.IssueURL != "" {
+			referenced[comment.IssueURL] = true
+		}
+	}
+
+	for _, comment := range comments {
+		fingerprint := comment.Fingerprint()
+		seen[fingerprint] = true
+
+		entry, ok := l.Lookup(fingerprint)
+		switch {
+		case ok:
+			entry.FilePath = comment.FilePath
+			entry.Cell = comment.Cell
+			entry.LineNumber = comment.LineNumber
+			entry.Title = comment.Title
+			entry.Status = LedgerStatusOpen
+
+			if comment.IssueURL == "" && entry.IssueURL != "" && !referenced[entry.IssueURL] {
+				comment.IssueURL = entry.IssueURL
+				result.Restored = append(result.Restored, comment)
+			}
+		case comment.IssueURL != "":
+			l.Record(comment, now)
+			result.Adopted++
+		}
+
+		result.Comments = append(result.Comments, comment)
+	}
+
+	for i := range l.Entries {
+		if !seen[l.Entries[i].Fingerprint] && l.Entries[i].Status == LedgerStatusOpen {
+			l.Entries[i].Status = LedgerStatusRemoved
+			result.Removed++
+		}
+	}
+
+	return result
+}
+
+// Merge adds the entries and queued write-backs of latest missing from the ledger, such as
+// the ones saved by a concurrent run since the ledger was loaded. Entries and write-backs
+// present in both keep their state in the ledger. A write-back this run already completed
+// may be queued again, the next run finds the issue referenced and drops it.
+func (l *Ledger) Merge(latest *Ledger) {
+	for _, entry := range latest.Entries {
+		if _, ok := l.Lookup(entry.Fingerprint); !ok {
+			l.Entries = append(l.Entries, entry)
+		}
+	}
+	for _, retry := range latest.Retries {
+		if !slices.ContainsFunc(l.Retries, func(e RetryEntry) bool { return e.Fingerprint == retry.Fingerprint }) {
+			l.Retries = append(l.Retries, retry)
+		}
+	}
+}
+
+// Summary returns the number of ledger entries per status
+func (l *Ledger) Summary() map[LedgerStatus]int {
+	summary := make(map[LedgerStatus]int)
+	for _, entry := range l.Entries {
+		summary[entry.Status]++
+	}
+	return summary
+}
+
+// MarshalLedger serializes the ledger with entries sorted by file and line for stable diffs
+func MarshalLedger(l *Ledger) ([]byte, error) {
+	sorted := *l
+	sorted.Version = LedgerVersion
+	sorted.Entries = append([]LedgerEntry(nil), l.Entries...)
+	sort.SliceStable(sorted.Entries, func(i, j int) bool {
+		a, b := sorted.Entries[i], sorted.Entries[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		if a.Cell != b.Cell {
+			return a.Cell < b.Cell
+		}
+		if a.LineNumber != b.LineNumber {
+			return a.LineNumber < b.LineNumber
+		}
+		return a.Fingerprint < b.Fingerprint
+	})
+
+	data, err := json.MarshalIndent(sorted, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// UnmarshalLedger parses a serialized ledger
+func UnmarshalLedger(data []byte) (*Ledger, error) {
+	ledger := NewLedger()
+	if err := json.Unmarshal(data, ledger); err != nil {
+		return nil, fmt.Errorf("failed to parse ledger: %w", err)
+	}
+	if ledger.Version > LedgerVersion {
+		return nil, fmt.Errorf("unsupported ledger version %d", ledger.Version)
+	}
+	return ledger, nil
+}
+
+// LoadLedgerFile reads the ledger from a local file, a missing file yields an empty ledger
+func LoadLedgerFile(path string) (*Ledger, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return NewLedger(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ledger %s: %w", path, err)
+	}
+	return UnmarshalLedger(data)
+}
+
+// SaveLedgerFile writes the ledger to a local file atomically by renaming a temporary file over it
+func SaveLedgerFile(path string, l *Ledger) error {
+	data, err := MarshalLedger(l)
+	if err != nil {
+		return fmt.Errorf("failed to serialize ledger: %w", err)
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes data to a local file by renaming a temporary file over it, so
+// readers never see a partially written file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", dir, err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return fmt.Errorf("failed to set permissions of %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+	return nil
+}
+
+// IssueNumberFromURL extracts the issue number from an issue URL, zero if it can't be found
+func IssueNumberFromURL(url string) int {
+	url = strings.TrimRight(strings.TrimSpace(url), "/")
+	n, err := strconv.Atoi(url[strings.LastIndex(url, "/")+1:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
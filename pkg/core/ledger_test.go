@@ -0,0 +1,141 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := TodoComment{FilePath: "pkg/core/parser.go", LineNumber: 10, Title: "Sample  task"}
+	b := TodoComment{FilePath: "pkg/core/parser.go", LineNumber: 42, Title: "sample task", Description: []string{"changed"}}
+	c := TodoComment{FilePath: "pkg/core/types.go", LineNumber: 10, Title: "Sample task"}
+
+	assert.Equal(t, a.Fingerprint(), b.Fingerprint(), "fingerprint should not depend on line or description")
+	assert.NotEqual(t, a.Fingerprint(), c.Fingerprint(), "fingerprint should depend on file")
+
+	twin := a
+	twin.Occurrence = 1
+	assert.NotEqual(t, a.Fingerprint(), twin.Fingerprint(), "puzzles sharing a title should have their own fingerprint")
+}
+
+func TestLedgerReconcileSameTitle(t *testing.T) {
+	content := "package main\n\n// TODO: Add tests\n// Issue: https://github.com/o/r/issues/7\nfunc a() {}\n\n// TODO: Add tests\nfunc b() {}\n"
+	comments, err := parseContent("main.go", []byte(content), 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, 0, comments[0].Occurrence)
+	assert.Equal(t, 1, comments[1].Occurrence)
+	assert.NotEqual(t, comments[0].Fingerprint(), comments[1].Fingerprint())
+
+	ledger := NewLedger()
+	ledger.Record(comments[0], time.Now())
+
+	result := ledger.Reconcile(comments, time.Now())
+	assert.Empty(t, result.Restored)
+	assert.Empty(t, result.Comments[1].IssueURL, "the new puzzle should get its own issue")
+
+	// A new puzzle inserted above takes the fingerprint of the processed one, whose issue
+	// is still referenced in the code
+	content = "package main\n\n// TODO: Add tests\nfunc c() {}\n\n" + content[len("package main\n\n"):]
+	comments, err = parseContent("main.go", []byte(content), 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 3)
+
+	ledger = NewLedger()
+	ledger.Record(TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Add tests", IssueURL: "https://github.com/o/r/issues/7"}, time.Now())
+
+	result = ledger.Reconcile(comments, time.Now())
+	assert.Empty(t, result.Restored)
+	assert.Empty(t, result.Comments[0].IssueURL)
+	assert.Equal(t, "https://github.com/o/r/issues/7", result.Comments[1].IssueURL)
+	assert.Empty(t, result.Comments[2].IssueURL)
+}
+
+func TestLedgerReconcile(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	now := created.Add(time.Hour)
+
+	ledger := NewLedger()
+	ledger.Record(TodoComment{FilePath: "a.go", LineNumber: 3, Title: "Lost issue line", IssueURL: "https://github.com/o/r/issues/7"}, created)
+	ledger.Record(TodoComment{FilePath: "b.go", LineNumber: 5, Title: "Removed puzzle", IssueURL: "https://github.com/o/r/issues/8"}, created)
+
+	comments := []TodoComment{
+		{FilePath: "a.go", LineNumber: 10, Title: "Lost issue line"},
+		{FilePath: "c.go", LineNumber: 1, Title: "Processed", IssueURL: "https://github.com/o/r/issues/9"},
+		{FilePath: "d.go", LineNumber: 1, Title: "New puzzle"},
+	}
+
+	result := ledger.Reconcile(comments, now)
+
+	require.Len(t, result.Comments, 3)
+	assert.Equal(t, "https://github.com/o/r/issues/7", result.Comments[0].IssueURL)
+	assert.Empty(t, result.Comments[2].IssueURL)
+	require.Len(t, result.Restored, 1)
+	assert.Equal(t, "Lost issue line", result.Restored[0].Title)
+	assert.Equal(t, 1, result.Adopted)
+	assert.Equal(t, 1, result.Removed)
+
+	entry, ok := ledger.Lookup(comments[0].Fingerprint())
+	require.True(t, ok)
+	assert.Equal(t, 10, entry.LineNumber)
+	assert.Equal(t, 7, entry.IssueNumber)
+	assert.Equal(t, created, entry.CreatedAt)
+
+	adopted, ok := ledger.Lookup(comments[1].Fingerprint())
+	require.True(t, ok)
+	assert.Equal(t, 9, adopted.IssueNumber)
+	assert.Equal(t, now, adopted.CreatedAt)
+
+	assert.Equal(t, map[LedgerStatus]int{LedgerStatusOpen: 2, LedgerStatusRemoved: 1}, ledger.Summary())
+}
+
+func TestLedgerFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".pdd", "ledger.json")
+
+	ledger, err := LoadLedgerFile(path)
+	require.NoError(t, err)
+	assert.Empty(t, ledger.Entries)
+
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ledger.Record(TodoComment{FilePath: "z.go", LineNumber: 1, Title: "Second", IssueURL: "https://github.com/o/r/issues/2"}, created)
+	ledger.Record(TodoComment{FilePath: "a.go", LineNumber: 1, Title: "First", IssueURL: "https://github.com/o/r/issues/1"}, created)
+	require.NoError(t, SaveLedgerFile(path, ledger))
+
+	loaded, err := LoadLedgerFile(path)
+	require.NoError(t, err)
+	require.Len(t, loaded.Entries, 2)
+	assert.Equal(t, "a.go", loaded.Entries[0].FilePath, "entries should be sorted by file")
+	assert.Equal(t, LedgerStatusOpen, loaded.Entries[1].Status)
+
+	files, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary files should not be left behind")
+}
+
+func TestLedgerMerge(t *testing.T) {
+	created := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	ledger := NewLedger()
+	ledger.Record(TodoComment{FilePath: "a.go", Title: "First", IssueURL: "https://github.com/o/r/issues/1"}, created)
+	ledger.Retries = RetryQueue{{Fingerprint: "retry1", IssueURL: "https://github.com/o/r/issues/1"}}
+
+	// A concurrent run recorded another puzzle and closed the issue of the first one
+	latest := NewLedger()
+	latest.Record(TodoComment{FilePath: "a.go", Title: "First", IssueURL: "https://github.com/o/r/issues/1"}, created)
+	latest.Entries[0].Status = LedgerStatusClosed
+	latest.Record(TodoComment{FilePath: "b.go", Title: "Second", IssueURL: "https://github.com/o/r/issues/2"}, created)
+	latest.Retries = RetryQueue{{Fingerprint: "retry1"}, {Fingerprint: "retry2"}}
+
+	ledger.Merge(latest)
+
+	require.Len(t, ledger.Entries, 2)
+	assert.Equal(t, LedgerStatusOpen, ledger.Entries[0].Status, "entries of the ledger should keep their state")
+	assert.Equal(t, "b.go", ledger.Entries[1].FilePath)
+	require.Len(t, ledger.Retries, 2)
+	assert.Equal(t, "https://github.com/o/r/issues/1", ledger.Retries[0].IssueURL)
+	assert.Equal(t, "retry2", ledger.Retries[1].Fingerprint)
+}
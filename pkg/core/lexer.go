@@ -0,0 +1,235 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+)
+
+// langAttributeRegex matches the language attribute of an embedded section such as <script lang="ts">
+var langAttributeRegex = regexp.MustCompile(`\blang=["']?([\w-]+)`)
+
+// commentLexer extracts comment text line by line, tracking open block comments and, for
+// languages with embedded sections, the region each line belongs to
+type commentLexer struct {
+	lang     *Language
+	prefixes []string
+	blocks   []BlockComment
+	nested   bool
+
+	// block is the open block comment, nil outside block comments
+	block *BlockComment
+	depth int
+
+	regions []lexerRegion
+	// region is the embedded section the lexer is in and inner lexes its lines, nil outside regions
+	region *lexerRegion
+	inner  *commentLexer
+}
+
+// lexerRegion is an embedded section with compiled delimiters
+type lexerRegion struct {
+	start    *regexp.Regexp
+	end      *regexp.Regexp
+	language string
+}
+
+// newCommentLexer creates a lexer for the comment syntax of a language
+func newCommentLexer(lang *Language) *commentLexer {
+	l := newSectionLexer(lang)
+	for _, region := range lang.Regions {
+		start, errStart := regexp.Compile(region.Start)
+		end, errEnd := regexp.Compile(region.End)
+		if errStart != nil || errEnd != nil {
+			continue // Invalid regions are rejected when languages are loaded
+		}
+		l.regions = append(l.regions, lexerRegion{start: start, end: end, language: region.Language})
+		if region.Initial && l.region == nil {
+			l.enterRegion(&l.regions[len(l.regions)-1], "")
+		}
+	}
+	return l
+}
+
+// newSectionLexer creates a lexer for the comment syntax of a language ignoring its regions
+func newSectionLexer(lang *Language) *commentLexer {
+	return &commentLexer{
+		lang:     lang,
+		prefixes: lang.lineCommentPrefixes(),
+		blocks:   lang.blockComments(),
+		nested:   lang.NestedComments,
+	}
+}
+
+// language returns the language of the region the lexer is in
+func (l *commentLexer) language() *Language {
+	if l.inner != nil {
+		return l.inner.lang
+	}
+	return l.lang
+}
+
+// next returns the comment text of a line, whether the line is part of a comment and
+// whether it closes a block comment
+func (l *commentLexer) next(line string) (content string, isComment, closesBlock bool) {
+	if l.inner != nil && l.inner.block != nil {
+		// Region delimiters inside a block comment of the region are part of the comment
+		return l.inner.next(line)
+	}
+
+	if l.block == nil && l.switchRegion(strings.TrimSpace(line)) {
+		// Lines with region delimiters are treated as code
+		return "", false, false
+	}
+
+	if l.inner != nil {
+		return l.inner.next(line)
+	}
+
+	trimmed := strings.TrimSpace(line)
+	if l.block != nil {
+		return l.inside(trimmed)
+	}
+
+	// Block delimiters are checked first as some, such as "#[", start with a line comment prefix
+	for _, block := range l.blocks {
+		if strings.HasPrefix(trimmed, block.Start) {
+			return l.open(block, trimmed[len(block.Start):])
+		}
+	}
+
+	if prefix := matchPrefix(trimmed, l.prefixes); prefix != "" {
+		content = trimmed
+		for strings.HasPrefix(content, prefix) {
+			// Strip repeated markers such as ";;;" in Lisp
+			content = strings.TrimPrefix(content, prefix)
+		}
+		return strings.TrimSpace(content), true, false
+	}
+
+	// A block comment may start after code; one that also ends on the line belongs to the code
+	for _, block := range l.blocks {
+		if i := strings.Index(trimmed, block.Start); i >= 0 {
+			rest := trimmed[i+len(block.Start):]
+			if !strings.Contains(rest, block.End) {
+				return l.open(block, rest)
+			}
+		}
+	}
+
+	return "", false, false
+}
+
+// switchRegion follows the region delimiters on a line and reports whether there were any.
+// A region may open and close on the same line, so the region the line ends in is kept.
+func (l *commentLexer) switchRegion(line string) bool {
+	if len(l.regions) == 0 {
+		return false
+	}
+
+	switched := false
+	pos := 0
+	for pos <= len(line) {
+		if l.region != nil {
+			loc := l.region.end.FindStringIndex(line[pos:])
+			if loc == nil {
+				break
+			}
+			l.region, l.inner = nil, nil
+			pos += max(loc[1], 1)
+			switched = true
+			continue
+		}
+
+		var next *lexerRegion
+		var nextLoc []int
+		for i := range l.regions {
+			if loc := l.regions[i].start.FindStringIndex(line[pos:]); loc != nil && (nextLoc == nil || loc[0] < nextLoc[0]) {
+				next, nextLoc = &l.regions[i], loc
+			}
+		}
+		if next == nil {
+			break
+		}
+
+		l.enterRegion(next, line[pos+nextLoc[0]:])
+		pos += max(nextLoc[1], 1)
+		switched = true
+	}
+
+	return switched
+}
+
+// enterRegion starts lexing an embedded section. The language attribute of the opening
+// tag, such as lang="ts", takes precedence over the language declared for the region.
+func (l *commentLexer) enterRegion(region *lexerRegion, tag string) {
+	var lang *Language
+	if match := langAttributeRegex.FindStringSubmatch(tag); match != nil {
+		lang = languageByAlias(match[1])
+	}
+	if lang == nil {
+		lang = languageByName(region.language)
+	}
+	if lang == nil {
+		lang = l.lang
+	}
+
+	l.region = region
+	l.inner = newSectionLexer(lang)
+}
+
+// open starts a block comment whose text after the start delimiter is rest
+func (l *commentLexer) open(block BlockComment, rest string) (string, bool, bool) {
+	l.block = &block
+	l.depth = 1
+	return l.inside(rest)
+}
+
+// inside returns the comment text of a line inside the open block comment, closing the
+// block when its end delimiter is found
+func (l *commentLexer) inside(text string) (string, bool, bool) {
+	pos := 0
+	for {
+		end := strings.Index(text[pos:], l.block.End)
+		if l.nested {
+			start := strings.Index(text[pos:], l.block.Start)
+			if start >= 0 && (end < 0 || start < end) {
+				l.depth++
+				pos += start + len(l.block.Start)
+				continue
+			}
+		}
+		if end < 0 {
+			return cleanBlockLine(text), true, false
+		}
+
+		l.depth--
+		if l.depth == 0 {
+			content := text[:pos+end]
+			l.block = nil
+			return cleanBlockLine(content), true, true
+		}
+		pos += end + len(l.block.End)
+	}
+}
+
+// cleanBlockLine trims a block comment line and its leading decoration such as " * "
+func cleanBlockLine(text string) string {
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "*") {
+		text = strings.TrimSpace(strings.TrimLeft(text, "*"))
+	}
+	return text
+}
+
+// languageAt returns the language of the region containing the line at index
+func languageAt(lang *Language, lines []string, index int) *Language {
+	if len(lang.Regions) == 0 {
+		return lang
+	}
+
+	lexer := newCommentLexer(lang)
+	for _, line := range lines[:index] {
+		lexer.next(line)
+	}
+	return lexer.language()
+}
@@ -0,0 +1,392 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// notebookExtension is the extension of Jupyter notebooks
+const notebookExtension = ".ipynb"
+
+// notebook is the part of a Jupyter notebook document used to find TODO comments
+type notebook struct {
+	Metadata struct {
+		KernelSpec struct {
+			Language string `json:"language"`
+		} `json:"kernelspec"`
+		LanguageInfo struct {
+			Name string `json:"name"`
+		} `json:"language_info"`
+	} `json:"metadata"`
+	Cells []notebookCell `json:"cells"`
+}
+
+// notebookCell is a single notebook cell
+type notebookCell struct {
+	CellType string         `json:"cell_type"`
+	Source   notebookSource `json:"source"`
+}
+
+// notebookSource is the source of a cell, stored either as a string or as a list of lines
+type notebookSource string
+
+// UnmarshalJSON decodes a cell source in either form
+func (s *notebookSource) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*s = notebookSource(text)
+		return nil
+	}
+
+	var lines []string
+	if err := json.Unmarshal(data, &lines); err != nil {
+		return err
+	}
+	*s = notebookSource(strings.Join(lines, ""))
+	return nil
+}
+
+// isNotebook reports whether the file is a Jupyter notebook
+func isNotebook(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), notebookExtension)
+}
+
+// kernelLanguage returns the language of the notebook kernel, Python when it is not recorded
+func (nb *notebook) kernelLanguage() *Language {
+	for _, name := range []string{nb.Metadata.KernelSpec.Language, nb.Metadata.LanguageInfo.Name} {
+		if name == "" {
+			continue
+		}
+		if lang := languageByAlias(name); lang != nil {
+			return lang
+		}
+		if lang := languageByName(name); lang != nil {
+			return lang
+		}
+	}
+	return languageByName("Python")
+}
+
+// cellLanguage returns the language of a code cell, which a cell magic such as %%bash
+// on its first line switches from the kernel language
+func cellLanguage(kernel *Language, source string) *Language {
+	firstLine, _, _ := strings.Cut(source, "\n")
+	if magic, ok := strings.CutPrefix(strings.TrimSpace(firstLine), "%%"); ok {
+		if name := strings.Fields(magic); len(name) > 0 {
+			if lang := languageByAlias(name[0]); lang != nil {
+				return lang
+			}
+		}
+	}
+	return kernel
+}
+
+// parseNotebook parses TODO comments in the code cells of a Jupyter notebook. Comments are
+// located by the one-based index of their cell and their line within the cell.
+func parseNotebook(path string, data []byte, terminators Terminators) ([]TodoComment, error) {
+	var nb notebook
+	if err := json.Unmarshal(data, &nb); err != nil {
+		return nil, fmt.Errorf("failed to parse notebook %s: %w: %w", path, ErrInvalidContent, err)
+	}
+
+	kernel := nb.kernelLanguage()
+
+	var comments []TodoComment
+	for i, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+
+		source := string(cell.Source)
+		lang := cellLanguage(kernel, source)
+		if lang == nil {
+			continue
+		}
+
+		for _, comment := range parseLines(path, lang, strings.Split(source, "\n"), terminators) {
+			comment.Cell = i + 1
+			comments = append(comments, comment)
+		}
+	}
+
+	return comments, nil
+}
+
+// insertNotebookReference writes the issue of a comment in a notebook cell back in the given
+// format. Only the source of the cell is rewritten, and within it only the lines that changed,
+// so the notebook keeps its indentation, key order and escaping.
+func insertNotebookReference(content []byte, comment TodoComment, format ReferenceFormat) ([]byte, bool, error) {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return nil, false, fmt.Errorf("failed to parse notebook %s: %w", comment.FilePath, err)
+	}
+	if comment.Cell < 1 || comment.Cell > len(nb.Cells) {
+		return nil, false, fmt.Errorf("cell %d is out of range for notebook %s", comment.Cell, comment.FilePath)
+	}
+
+	source := string(nb.Cells[comment.Cell-1].Source)
+	text, err := DecodeText([]byte(source))
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed, err := insertReference(text, cellLanguage(nb.kernelLanguage(), source), comment, format)
+	if err != nil || !changed {
+		return content, false, err
+	}
+
+	start, end, err := cellSourceOffsets(content, comment.Cell-1)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to locate cell %d in notebook %s: %w", comment.Cell, comment.FilePath, err)
+	}
+
+	replacement, err := encodeCellSource(content[start:end], text)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(content) + len(replacement) - (end - start))
+	buf.Write(content[:start])
+	buf.Write(replacement)
+	buf.Write(content[end:])
+	return buf.Bytes(), true, nil
+}
+
+// cellSourceOffsets returns the byte range of the source value of the cell with the given index
+func cellSourceOffsets(data []byte, cellIndex int) (int, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, 0, err
+	}
+
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+		if key != "cells" {
+			if err := skipValue(dec); err != nil {
+				return 0, 0, err
+			}
+			continue
+		}
+
+		if err := expectDelim(dec, '['); err != nil {
+			return 0, 0, err
+		}
+		for i := 0; dec.More(); i++ {
+			if i != cellIndex {
+				if err := skipValue(dec); err != nil {
+					return 0, 0, err
+				}
+				continue
+			}
+			return valueOffsets(dec, "source")
+		}
+	}
+
+	return 0, 0, fmt.Errorf("cell %d not found", cellIndex+1)
+}
+
+// valueOffsets returns the byte range of the value of key in the object the decoder is at
+func valueOffsets(dec *json.Decoder, key string) (int, int, error) {
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, 0, err
+	}
+	for dec.More() {
+		k, err := dec.Token()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return 0, 0, err
+		}
+		if k == key {
+			end := int(dec.InputOffset())
+			return end - len(raw), end, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("key %s not found", key)
+}
+
+// encodeCellSource encodes the updated cell text in the form of the original source. When
+// the source is a list with one element per line, only the elements of the lines that
+// changed are written, the others keep their original bytes.
+func encodeCellSource(raw []byte, text *TextFile) ([]byte, error) {
+	source := strings.Join(text.Lines, "\n") + trailingNewline(text)
+	if raw[0] != '[' {
+		return encodeJSONString(source)
+	}
+
+	lines := strings.SplitAfter(source, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	elements, values, err := arrayElements(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 || !isLinePerElement(values) {
+		return encodeLineArray(raw, lines)
+	}
+
+	prefix := 0
+	for prefix < len(values) && prefix < len(lines) && values[prefix] == lines[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(values)-prefix && suffix < len(lines)-prefix && values[len(values)-1-suffix] == lines[len(lines)-1-suffix] {
+		suffix++
+	}
+
+	changed := lines[prefix : len(lines)-suffix]
+	if len(changed) == 0 {
+		// Lines were only removed, which write-back never does
+		return encodeLineArray(raw, lines)
+	}
+
+	separator := []byte(", ")
+	if len(elements) > 1 {
+		separator = raw[elements[0][1]:elements[1][0]]
+	}
+
+	elementsOut := make([][]byte, 0, len(changed))
+	for _, line := range changed {
+		element, err := encodeJSONString(line)
+		if err != nil {
+			return nil, err
+		}
+		elementsOut = append(elementsOut, element)
+	}
+	encoded := bytes.Join(elementsOut, separator)
+
+	var start, end int
+	switch {
+	case prefix < len(values)-suffix:
+		// Replace the changed elements
+		start, end = elements[prefix][0], elements[len(values)-suffix-1][1]
+	case prefix < len(values):
+		// Insert before the first unchanged element
+		start, end = elements[prefix][0], elements[prefix][0]
+		encoded = append(encoded, separator...)
+	default:
+		// Append after the last element
+		start, end = elements[len(values)-1][1], elements[len(values)-1][1]
+		encoded = append(append([]byte(nil), separator...), encoded...)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(raw[:start])
+	buf.Write(encoded)
+	buf.Write(raw[end:])
+	return buf.Bytes(), nil
+}
+
+// encodeLineArray encodes lines as a list with one element per line, indented like the original list
+func encodeLineArray(raw []byte, lines []string) ([]byte, error) {
+	indent, closing := "", ""
+	if rest := raw[1:]; len(rest) > 0 && (rest[0] == '\n' || rest[0] == '\r') {
+		body := strings.TrimLeft(string(rest), "\r\n")
+		indent = "\n" + body[:len(body)-len(strings.TrimLeft(body, " \t"))]
+		trimmed := strings.TrimRight(string(raw[:len(raw)-1]), " \t")
+		closing = "\n" + string(raw[len(trimmed):len(raw)-1])
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i, line := range lines {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encoded, err := encodeJSONString(line)
+		if err != nil {
+			return nil, err
+		}
+		buf.WriteString(indent)
+		buf.Write(encoded)
+	}
+	buf.WriteString(closing)
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// arrayElements returns the byte ranges and string values of the elements of a JSON list of strings
+func arrayElements(raw []byte) ([][2]int, []string, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if err := expectDelim(dec, '['); err != nil {
+		return nil, nil, err
+	}
+
+	var elements [][2]int
+	var values []string
+	for dec.More() {
+		var element json.RawMessage
+		if err := dec.Decode(&element); err != nil {
+			return nil, nil, err
+		}
+		end := int(dec.InputOffset())
+
+		var value string
+		if err := json.Unmarshal(element, &value); err != nil {
+			return nil, nil, err
+		}
+		elements = append(elements, [2]int{end - len(element), end})
+		values = append(values, value)
+	}
+	return elements, values, nil
+}
+
+// isLinePerElement reports whether every element holds exactly one line, terminated except for the last
+func isLinePerElement(values []string) bool {
+	for i, value := range values {
+		body := strings.TrimSuffix(value, "\n")
+		if strings.Contains(body, "\n") || (i < len(values)-1 && body == value) {
+			return false
+		}
+	}
+	return true
+}
+
+// trailingNewline returns the terminator of the last line of text
+func trailingNewline(text *TextFile) string {
+	if text.TrailingNewline() {
+		return "\n"
+	}
+	return ""
+}
+
+// encodeJSONString encodes s as a JSON string without escaping HTML characters, as Jupyter does
+func encodeJSONString(s string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// expectDelim reads the next token and checks that it is the given delimiter
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %s, got %v", delim, tok)
+	}
+	return nil
+}
+
+// skipValue reads and discards the next value
+func skipValue(dec *json.Decoder) error {
+	var raw json.RawMessage
+	return dec.Decode(&raw)
+}
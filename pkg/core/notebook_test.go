@@ -0,0 +1,132 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testNotebook = `{
+ "cells": [
+  {
+   "cell_type": "markdown",
+   "metadata": {},
+   "source": [
+    "# TODO: Not a puzzle in markdown\n"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": null,
+   "metadata": {},
+   "outputs": [],
+   "source": [
+    "import pandas as pd\n",
+    "# TODO: Load the <real> dataset\n",
+    "# Use the S3 bucket\n",
+    "df = pd.DataFrame()"
+   ]
+  },
+  {
+   "cell_type": "code",
+   "execution_count": null,
+   "metadata": {},
+   "outputs": [],
+   "source": "%%bash\n# TODO: Replace the download script\nls"
+  }
+ ],
+ "metadata": {
+  "kernelspec": {
+   "display_name": "Python 3",
+   "language": "python",
+   "name": "python3"
+  }
+ },
+ "nbformat": 4,
+ "nbformat_minor": 5
+}
+`
+
+func TestParseNotebook(t *testing.T) {
+	comments, err := parseNotebook("analysis.ipynb", []byte(testNotebook), 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+
+	assert.Equal(t, 2, comments[0].Cell)
+	assert.Equal(t, 2, comments[0].LineNumber)
+	assert.Equal(t, "Load the <real> dataset", comments[0].Title)
+	assert.Equal(t, []string{"Use the S3 bucket"}, comments[0].Description)
+	assert.Equal(t, "analysis.ipynb:cell2:2", comments[0].Location())
+
+	// The %%bash cell magic switches the cell to shell comments
+	assert.Equal(t, 3, comments[1].Cell)
+	assert.Equal(t, 2, comments[1].LineNumber)
+	assert.Equal(t, "Replace the download script", comments[1].Title)
+	assert.Equal(t, "cell 3, line 2", comments[1].Position())
+}
+
+func TestParseNotebookKernelLanguage(t *testing.T) {
+	nb := `{"cells": [{"cell_type": "code", "source": ["// TODO: Plot results\n", "# not a comment"]}],
+	"metadata": {"kernelspec": {"language": "javascript"}}}`
+
+	comments, err := parseNotebook("plot.ipynb", []byte(nb), 0)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Plot results", comments[0].Title)
+
+	_, err = parseNotebook("broken.ipynb", []byte("{"), 0)
+	assert.Error(t, err)
+}
+
+func TestScanDirectoryNotebook(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "analysis.ipynb"), []byte(testNotebook), 0o600))
+
+	comments, err := ScanDirectory(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, comments, 2)
+	assert.Equal(t, 2, comments[0].Cell)
+	assert.Equal(t, 3, comments[1].Cell)
+}
+
+func TestInsertNotebookIssueLine(t *testing.T) {
+	comment := TodoComment{FilePath: "analysis.ipynb", Cell: 2, LineNumber: 2, IssueURL: "https://github.com/o/r/issues/7"}
+
+	got, changed, err := InsertIssueLine([]byte(testNotebook), comment)
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	// Only the new element is added, keeping indentation, key order and unescaped characters
+	want := `    "# TODO: Load the <real> dataset\n",
+    "# Issue: https://github.com/o/r/issues/7\n",
+    "# Use the S3 bucket\n",`
+	assert.Contains(t, string(got), want)
+	assert.Equal(t, len(testNotebook)+len(`    "# Issue: https://github.com/o/r/issues/7\n",`)+1, len(got))
+
+	comments, err := parseNotebook("analysis.ipynb", got, 0)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.com/o/r/issues/7", comments[0].IssueURL)
+}
+
+func TestInsertNotebookIssueLineSourceForms(t *testing.T) {
+	url := "https://github.com/o/r/issues/7"
+
+	// Cell source stored as a single string
+	got, changed, err := InsertIssueLine([]byte(testNotebook), TodoComment{FilePath: "a.ipynb", Cell: 3, LineNumber: 2, IssueURL: url})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, string(got), `"source": "%%bash\n# TODO: Replace the download script\n# Issue: `+url+`\nls"`)
+
+	// TODO on the last, unterminated line of a list
+	nb := `{"cells": [{"cell_type": "code", "source": ["x = 1\n", "# TODO: Tidy up"]}]}`
+	got, changed, err = InsertIssueLine([]byte(nb), TodoComment{FilePath: "a.ipynb", Cell: 1, LineNumber: 2, IssueURL: url})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `{"cells": [{"cell_type": "code", "source": ["x = 1\n", "# TODO: Tidy up\n", "# Issue: `+url+`"]}]}`, string(got))
+
+	_, _, err = InsertIssueLine([]byte(nb), TodoComment{FilePath: "a.ipynb", Cell: 2, LineNumber: 1, IssueURL: url})
+	assert.Error(t, err)
+}
@@ -1,189 +1,274 @@
 package core
 
 import (
-	"bufio"
-	"os"
+	"fmt"
+	"io"
 	"path/filepath"
 	"regexp"
 	"strings"
 )
 
-// Language defines comment styles for different programming languages
-type Language struct {
-	Extensions        []string
-	LineComment       string
-	BlockCommentStart string
-	BlockCommentEnd   string
-}
+var (
+	// todoRegex matches TODO: and the Go style TODO(owner): and TODO(#123): markers
+	todoRegex   = regexp.MustCompile(`TODO(?:\(([^()]*)\))?:(.+)`)
+	markerRegex = regexp.MustCompile(`TODO(?:\([^()]*\))?:`)
+	labelsRegex = regexp.MustCompile(`Labels:(.+)`)
+	issueRegex  = regexp.MustCompile(`Issue:(.+)`)
+	endRegex    = regexp.MustCompile(`^End:?$`)
+	// directiveRegex matches the suppression directives pdd:ignore, pdd:disable-file,
+	// pdd:disable and pdd:enable
+	directiveRegex = regexp.MustCompile(`\bpdd:(ignore|disable-file|disable|enable)\b`)
+)
+
+// disableFileLines is how close to the top of a file pdd:disable-file must be
+const disableFileLines = 10
+
+// Terminators is a set of comment lines that end a puzzle before the end of its comment
+type Terminators uint8
 
-var supportedLanguages = []Language{
-	{Extensions: []string{".go"}, LineComment: "//"},
-	{Extensions: []string{".java", ".js", ".ts", ".jsx", ".tsx", ".c", ".cpp", ".cs", ".h", ".hpp", ".swift", ".kt", ".rs", ".php", ".scala", ".groovy"}, LineComment: "//", BlockCommentStart: "/*", BlockCommentEnd: "*/"},
-	{Extensions: []string{".py", ".rb", ".pl", ".r", ".sh", ".bash"}, LineComment: "#"},
-	{Extensions: []string{".lua"}, LineComment: "--"},
-	{Extensions: []string{".sql"}, LineComment: "--", BlockCommentStart: "/*", BlockCommentEnd: "*/"},
-	{Extensions: []string{".html", ".xml"}, BlockCommentStart: "<!--", BlockCommentEnd: "-->"},
-	{Extensions: []string{".css"}, BlockCommentStart: "/*", BlockCommentEnd: "*/"},
-	{Extensions: []string{".ex", ".exs"}, LineComment: "#"},
-	{Extensions: []string{".erl", ".hrl"}, LineComment: "%"},
-	{Extensions: []string{".hs"}, LineComment: "--", BlockCommentStart: "{-", BlockCommentEnd: "-}"},
-	{Extensions: []string{".ps1"}, LineComment: "#"},
-	{Extensions: []string{".fs"}, LineComment: "//", BlockCommentStart: "(*", BlockCommentEnd: "*)"},
-	{Extensions: []string{".m"}, LineComment: "//", BlockCommentStart: "/*", BlockCommentEnd: "*/"},
-	{Extensions: []string{".md", ".markdown"}, LineComment: "//"},
+const (
+	// TerminatorBlankLine ends a puzzle at an empty comment line
+	TerminatorBlankLine Terminators = 1 << iota
+	// TerminatorDedent ends a puzzle at a description line indented less than its TODO marker
+	TerminatorDedent
+	// TerminatorEnd ends a puzzle at an End directive line
+	TerminatorEnd
+)
+
+// terminatorNames maps the names accepted by ParseTerminators to terminators
+var terminatorNames = map[string]Terminators{
+	"blank":  TerminatorBlankLine,
+	"dedent": TerminatorDedent,
+	"end":    TerminatorEnd,
 }
 
-// GetLanguageForFile determines the language of a file based on its extension
-func GetLanguageForFile(filename string) *Language {
-	ext := filepath.Ext(filename)
-	for _, lang := range supportedLanguages {
-		for _, langExt := range lang.Extensions {
-			if ext == langExt {
-				return &lang
-			}
+// ParseTerminators parses a comma separated list of terminator names: blank, dedent and
+// end. An empty list or "none" disables terminators.
+func ParseTerminators(value string) (Terminators, error) {
+	var terminators Terminators
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || name == "none" {
+			continue
+		}
+
+		terminator, ok := terminatorNames[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown puzzle terminator: %s", name)
 		}
+		terminators |= terminator
 	}
-	return nil
+	return terminators, nil
 }
 
-// ParseTodoComments scans a file for TODO comments in the specified format
+// ParseTodoComments scans a file for TODO comments in the specified format. A puzzle ends
+// at the next TODO marker or at the end of its comment.
 func ParseTodoComments(filePath string) ([]TodoComment, error) {
-	file, err := os.Open(filePath)
+	return parseFile(filePath, 0)
+}
+
+// parseReader parses TODO comments from the content of a file in the given language.
+// The content is decoded with DecodeText, so lines of any length, CRLF line endings,
+// byte order marks and UTF-16 or Latin-1 encoded files are supported.
+func parseReader(filePath string, lang *Language, r io.Reader) ([]TodoComment, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	lang := GetLanguageForFile(filePath)
-	if lang == nil {
-		return nil, nil // Unsupported file type
+	text, err := DecodeText(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", filePath, err)
 	}
 
-	var comments []TodoComment
-	scanner := bufio.NewScanner(file)
-
-	todoRegex := regexp.MustCompile(`TODO:(.+)`)
-	labelsRegex := regexp.MustCompile(`Labels:(.+)`)
-	issueRegex := regexp.MustCompile(`Issue:(.+)`)
-
-	lineNum := 0
-	var currentComment *TodoComment
-	var inBlockComment bool
+	return parseLines(filePath, lang, text.Lines, 0), nil
+}
 
-	for scanner.Scan() {
-		lineNum++
-		line := scanner.Text()
-		trimmedLine := strings.TrimSpace(line)
+// parseLines parses TODO comments from the decoded lines of a file in the given language
+func parseLines(filePath string, lang *Language, lines []string, terminators Terminators) []TodoComment {
+	collector := todoCollector{filePath: filePath, terminators: terminators}
+	lexer := newCommentLexer(lang)
 
-		// Handle block comments start/end
-		if lang.BlockCommentStart != "" && strings.Contains(trimmedLine, lang.BlockCommentStart) {
-			inBlockComment = true
-		}
-		if lang.BlockCommentEnd != "" && strings.Contains(trimmedLine, lang.BlockCommentEnd) {
-			inBlockComment = false
+	for i, line := range lines {
+		commentContent, isComment, closesBlock := lexer.next(line)
+		if !isComment {
+			// A non-comment line ends the TODO being collected
+			collector.finish()
 			continue
 		}
 
-		// Check if the line is a comment
-		isComment := false
-		commentContent := ""
+		collector.add(i+1, line, commentContent)
 
-		if lang.LineComment != "" && strings.HasPrefix(trimmedLine, lang.LineComment) {
-			isComment = true
-			commentContent = strings.TrimSpace(strings.TrimPrefix(trimmedLine, lang.LineComment))
-		} else if inBlockComment {
-			isComment = true
-			commentContent = trimmedLine
+		// A TODO inside a block comment ends with the block
+		if closesBlock {
+			collector.finish()
 		}
+	}
 
-		if !isComment {
-			// If we were collecting a comment and found a non-comment line, finalize the current comment
-			if currentComment != nil {
-				comments = append(comments, *currentComment)
-				currentComment = nil
-			}
-			continue
-		}
+	return collector.result()
+}
+
+// todoCollector assembles TODO comments from the text of consecutive comment lines
+type todoCollector struct {
+	filePath    string
+	terminators Terminators
+	symbol      func(line int) string
+	current     *TodoComment
+	// column is the position of the TODO marker of the current comment in its line
+	column   int
+	comments []TodoComment
+
+	// disabled is set in pdd:disable regions and disabledFile by pdd:disable-file
+	disabled     bool
+	disabledFile bool
+}
+
+// add processes the text of a comment line
+func (c *todoCollector) add(lineNum int, line, commentContent string) {
+	directive := ""
+	if match := directiveRegex.FindStringSubmatch(commentContent); match != nil {
+		directive = match[1]
+		commentContent = strings.TrimSpace(directiveRegex.ReplaceAllString(commentContent, ""))
+	}
 
-		// Process comment content
-		if todoMatch := todoRegex.FindStringSubmatch(commentContent); todoMatch != nil && currentComment == nil {
-			// Start a new TODO comment
-			title := strings.TrimSpace(todoMatch[1])
-			currentComment = &TodoComment{
-				FilePath:   filePath,
-				LineNumber: lineNum,
-				Title:      title,
-			}
-		} else if currentComment != nil {
-			// Check for existing issue URL
-			if issueMatch := issueRegex.FindStringSubmatch(commentContent); issueMatch != nil {
-				currentComment.IssueURL = strings.TrimSpace(issueMatch[1])
-			} else if labelsMatch := labelsRegex.FindStringSubmatch(commentContent); labelsMatch != nil {
-				// Extract labels
-				labelsStr := strings.TrimSpace(labelsMatch[1])
-				labels := strings.Split(labelsStr, ",")
-				for i, label := range labels {
-					labels[i] = strings.TrimSpace(label)
-				}
-				currentComment.Labels = labels
-			} else if commentContent != "" {
-				// Add to description if not a special directive
-				currentComment.Description = append(currentComment.Description, commentContent)
-			}
+	switch {
+	case directive == "disable-file" && lineNum <= disableFileLines:
+		c.disabledFile = true
+	case directive == "disable":
+		c.disabled = true
+	case directive == "enable":
+		c.disabled = false
+	}
+
+	if todoMatch := todoRegex.FindStringSubmatch(commentContent); todoMatch != nil {
+		// Every TODO marker starts a new puzzle, ending the one before it in the same comment
+		c.finish()
+		c.column = todoMarkerIndex(line)
+		c.current = &TodoComment{
+			FilePath:   c.filePath,
+			LineNumber: lineNum,
+			EndLine:    lineNum,
+			Title:      strings.TrimSpace(todoMatch[2]),
+		}
+		c.current.Ignored = c.disabled || directive == "ignore"
+		if owner := strings.TrimSpace(todoMatch[1]); issueReferenceRegex.MatchString(owner) {
+			// The puzzle already has an issue
+			c.current.IssueRef = owner
+		} else {
+			c.current.Assignee = strings.TrimPrefix(owner, "@")
+		}
+		if c.symbol != nil {
+			c.current.Symbol = c.symbol(lineNum)
 		}
+		return
 	}
 
-	// Add the last comment if there is one
-	if currentComment != nil {
-		comments = append(comments, *currentComment)
+	if c.current == nil || directive != "" {
+		// Directive lines are not part of the description
+		return
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if c.terminates(line, commentContent) {
+		c.finish()
+		return
 	}
 
-	return comments, nil
+	c.current.EndLine = lineNum
+
+	// Check for existing issue URL
+	if issueMatch := issueRegex.FindStringSubmatch(commentContent); issueMatch != nil {
+		// Issue lines hold either the issue URL or a reference such as #123
+		if issue := strings.TrimSpace(issueMatch[1]); issueReferenceRegex.MatchString(issue) {
+			c.current.IssueRef = issue
+		} else {
+			c.current.IssueURL = issue
+		}
+	} else if labelsMatch := labelsRegex.FindStringSubmatch(commentContent); labelsMatch != nil {
+		// Extract labels
+		labels := strings.Split(strings.TrimSpace(labelsMatch[1]), ",")
+		for i, label := range labels {
+			labels[i] = strings.TrimSpace(label)
+		}
+		c.current.Labels = labels
+	} else if commentContent != "" {
+		// Add to description if not a special directive
+		c.current.Description = append(c.current.Description, commentContent)
+	}
 }
 
-// ScanDirectory recursively scans a directory for TODO comments
-func ScanDirectory(dir string, excludeDirs []string) ([]TodoComment, error) {
-	var allComments []TodoComment
+// todoMarkerIndex returns the index of the TODO marker in line, or -1
+func todoMarkerIndex(line string) int {
+	if loc := markerRegex.FindStringIndex(line); loc != nil {
+		return loc[0]
+	}
+	return -1
+}
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+// terminates reports whether a comment line ends the current TODO without being part of it
+func (c *todoCollector) terminates(line, commentContent string) bool {
+	switch {
+	case commentContent == "":
+		return c.terminators&TerminatorBlankLine != 0
+	case c.terminators&TerminatorEnd != 0 && endRegex.MatchString(commentContent):
+		return true
+	case issueRegex.MatchString(commentContent) || labelsRegex.MatchString(commentContent):
+		// Directives may be written at any indentation
+		return false
+	default:
+		return c.terminators&TerminatorDedent != 0 && strings.Index(line, commentContent) < c.column
+	}
+}
 
-		// Skip excluded directories
-		if info.IsDir() {
-			for _, excludeDir := range excludeDirs {
-				if strings.HasPrefix(path, excludeDir) {
-					return filepath.SkipDir
-				}
-			}
-			return nil
-		}
+// finish ends the TODO comment being collected
+func (c *todoCollector) finish() {
+	if c.current != nil {
+		c.comments = append(c.comments, *c.current)
+		c.current = nil
+	}
+}
 
-		// Parse files
-		comments, err := ParseTodoComments(path)
-		if err != nil {
-			return err
+// result finishes the last TODO comment and returns all collected comments
+func (c *todoCollector) result() []TodoComment {
+	c.finish()
+	if c.disabledFile {
+		for i := range c.comments {
+			c.comments[i].Ignored = true
 		}
+	}
+	return c.comments
+}
 
-		allComments = append(allComments, comments...)
-		return nil
-	})
-
-	return allComments, err
+// matchPrefix returns the first of prefixes that line starts with, or an empty string
+func matchPrefix(line string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(line, prefix) {
+			return prefix
+		}
+	}
+	return ""
 }
 
-// FilterUnprocessedComments returns comments that don't have an issue URL
+// FilterUnprocessedComments returns comments that don't have an issue URL or reference
+// and are not suppressed by a pdd:ignore or pdd:disable directive
 func FilterUnprocessedComments(comments []TodoComment) []TodoComment {
 	var unprocessed []TodoComment
 	for _, comment := range comments {
-		if comment.IssueURL == "" {
+		if comment.IssueURL == "" && comment.IssueRef == "" && !comment.Ignored {
 			unprocessed = append(unprocessed, comment)
 		}
 	}
 	return unprocessed
 }
+
+// RelativePaths rewrites comment file paths to be relative to root using forward slashes,
+// as expected by the GitHub API
+func RelativePaths(comments []TodoComment, root string) []TodoComment {
+	result := make([]TodoComment, 0, len(comments))
+	for _, comment := range comments {
+		if rel, err := filepath.Rel(root, comment.FilePath); err == nil {
+			comment.FilePath = filepath.ToSlash(rel)
+		}
+		result = append(result, comment)
+	}
+	return result
+}
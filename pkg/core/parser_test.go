@@ -3,6 +3,7 @@ package core
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -81,9 +82,328 @@ func sampleFunc() {
 	assert.Equal(t, "Sample task", comments[0].Title)
 	assert.Equal(t, []string{"enhancement", "bug"}, comments[0].Labels)
 	assert.Equal(t, []string{"This is a description", "Spanning multiple lines"}, comments[0].Description)
+	assert.Equal(t, 5, comments[0].LineNumber)
+	assert.Equal(t, 8, comments[0].EndLine)
 
 	// Check the second comment
 	assert.Equal(t, "Another task", comments[1].Title)
 	assert.Empty(t, comments[1].Labels)
 	assert.Equal(t, []string{"This is another description"}, comments[1].Description)
 }
+
+func TestRelativePaths(t *testing.T) {
+	root := filepath.Join("workspace", "repo")
+	comments := []TodoComment{
+		{FilePath: filepath.Join(root, "pkg", "core", "parser.go"), Title: "Nested"},
+		{FilePath: filepath.Join(root, "main.go"), Title: "Top level"},
+	}
+
+	got := RelativePaths(comments, root)
+
+	assert.Equal(t, "pkg/core/parser.go", got[0].FilePath)
+	assert.Equal(t, "main.go", got[1].FilePath)
+	assert.Equal(t, filepath.Join(root, "main.go"), comments[1].FilePath, "input should not be modified")
+}
+
+func TestParseNestedBlockComments(t *testing.T) {
+	content := `{- outer
+   {- inner -}
+   TODO: Nested task
+   Still inside the outer comment
+-}
+main = pure ()
+`
+
+	comments, err := parseReader("file.hs", GetLanguageForFile("file.hs"), strings.NewReader(content))
+	assert.NoError(t, err)
+	if assert.Len(t, comments, 1) {
+		assert.Equal(t, "Nested task", comments[0].Title)
+		assert.Equal(t, []string{"Still inside the outer comment"}, comments[0].Description)
+	}
+}
+
+func TestParseTemplateComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		expected []TodoComment
+	}{
+		{
+			name:    "markdown multi-line comment",
+			file:    "README.md",
+			content: "# Title\n\n<!--\nTODO: Write docs\nLabels: documentation, help\n* Cover the setup\n-->\n\nText with // TODO: not a comment\n",
+			expected: []TodoComment{
+				{LineNumber: 4, EndLine: 7, Title: "Write docs", Labels: []string{"documentation", "help"}, Description: []string{"Cover the setup"}},
+			},
+		},
+		{
+			name:    "markdown single-line comments",
+			file:    "README.md",
+			content: "<!-- TODO: First -->\n<!-- TODO: Second\n     Issue: https://github.com/o/r/issues/2 -->\n",
+			expected: []TodoComment{
+				{LineNumber: 1, EndLine: 1, Title: "First"},
+				{LineNumber: 2, EndLine: 3, Title: "Second", IssueURL: "https://github.com/o/r/issues/2"},
+			},
+		},
+		{
+			name:    "jinja",
+			file:    "page.j2",
+			content: "{# TODO: Jinja task #}\n{{ value }}\n",
+			expected: []TodoComment{
+				{LineNumber: 1, EndLine: 1, Title: "Jinja task"},
+			},
+		},
+		{
+			name:    "go template",
+			file:    "page.tmpl",
+			content: "{{/* TODO: Template task\n     Details */}}\n{{.Value}}\n",
+			expected: []TodoComment{
+				{LineNumber: 1, EndLine: 2, Title: "Template task", Description: []string{"Details"}},
+			},
+		},
+		{
+			name:    "erb",
+			file:    "show.html.erb",
+			content: "<%# TODO: ERB task %>\n<%= value %>\n",
+			expected: []TodoComment{
+				{LineNumber: 1, EndLine: 1, Title: "ERB task"},
+			},
+		},
+		{
+			name:    "handlebars",
+			file:    "entry.hbs",
+			content: "{{!-- TODO: Long form --}}\n{{! TODO: Short form }}\n",
+			expected: []TodoComment{
+				{LineNumber: 1, EndLine: 1, Title: "Long form"},
+				{LineNumber: 2, EndLine: 2, Title: "Short form"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments, err := parseReader(tt.file, GetLanguageForFile(tt.file), strings.NewReader(tt.content))
+			assert.NoError(t, err)
+
+			for i := range tt.expected {
+				tt.expected[i].FilePath = tt.file
+			}
+			assert.Equal(t, tt.expected, comments)
+		})
+	}
+}
+
+func TestParseEmbeddedRegions(t *testing.T) {
+	content := `<template>
+  // TODO: Text in the template is not a comment
+  <!-- TODO: Template task -->
+</template>
+<script lang="ts">
+// TODO: Script task
+</script>
+<style>
+// TODO: Not a CSS comment
+/* TODO: Style task */
+</style>
+`
+
+	comments, err := parseReader("App.vue", GetLanguageForFile("App.vue"), strings.NewReader(content))
+	assert.NoError(t, err)
+
+	var titles []string
+	for _, comment := range comments {
+		titles = append(titles, comment.Title)
+	}
+	assert.Equal(t, []string{"Template task", "Script task", "Style task"}, titles)
+}
+
+func TestParsePHPRegions(t *testing.T) {
+	content := `<?php
+// TODO: PHP task
+?>
+<?xml-stylesheet type="text/xsl"
+  href="style.xsl"?>
+<!-- TODO: HTML task -->
+// TODO: Text in the HTML is not a comment
+<?
+// TODO: Short tag task
+?>
+<p><?= $value ?></p>
+<!-- TODO: Second HTML task -->
+`
+
+	comments, err := parseReader("page.php", GetLanguageForFile("page.php"), strings.NewReader(content))
+	assert.NoError(t, err)
+
+	var titles []string
+	for _, comment := range comments {
+		titles = append(titles, comment.Title)
+	}
+	assert.Equal(t, []string{"PHP task", "HTML task", "Short tag task", "Second HTML task"}, titles)
+
+	// An XML declaration spanning lines stays in the HTML
+	lines := strings.Split(content, "\n")
+	php := GetLanguageForFile("page.php")
+	assert.Equal(t, "HTML", languageAt(php, lines, 4).Name)
+	assert.Equal(t, "PHP", languageAt(php, lines, 8).Name)
+}
+
+func TestParsePHPLeadingHTML(t *testing.T) {
+	content := `<html>
+<!-- TODO: Leading HTML task -->
+# Heading
+// Not a comment in HTML
+<?php
+// TODO: PHP task
+?>
+`
+
+	comments, err := parseReader("page.php", GetLanguageForFile("page.php"), strings.NewReader(content))
+	assert.NoError(t, err)
+
+	var titles []string
+	for _, comment := range comments {
+		titles = append(titles, comment.Title)
+	}
+	assert.Equal(t, []string{"Leading HTML task", "PHP task"}, titles)
+
+	lines := strings.Split(content, "\n")
+	php := GetLanguageForFile("page.php")
+	assert.Equal(t, "HTML", languageAt(php, lines, 1).Name)
+	assert.Equal(t, "PHP", languageAt(php, lines, 5).Name)
+}
+
+func TestLanguageAt(t *testing.T) {
+	lines := strings.Split("<template>\n</template>\n<script lang=\"ts\">\n// x\n</script>\n<p>\n", "\n")
+	vue := GetLanguageForFile("App.vue")
+
+	assert.Equal(t, "Vue", languageAt(vue, lines, 1).Name)
+	assert.Equal(t, "TypeScript", languageAt(vue, lines, 3).Name)
+	assert.Equal(t, "Vue", languageAt(vue, lines, 5).Name)
+}
+
+func TestParseMultipleTodosInOneComment(t *testing.T) {
+	lines := []string{
+		"# TODO: First puzzle",
+		"# Labels: bug",
+		"# Details of the first",
+		"# TODO: Second puzzle",
+		"# Details of the second",
+		"x = 1",
+	}
+
+	comments := parseLines("file.py", GetLanguageForFile("file.py"), lines, 0)
+	assert.Len(t, comments, 2)
+	assert.Equal(t, "First puzzle", comments[0].Title)
+	assert.Equal(t, []string{"bug"}, comments[0].Labels)
+	assert.Equal(t, []string{"Details of the first"}, comments[0].Description)
+	assert.Equal(t, 3, comments[0].EndLine)
+	assert.Equal(t, "Second puzzle", comments[1].Title)
+	assert.Equal(t, 4, comments[1].LineNumber)
+	assert.Equal(t, []string{"Details of the second"}, comments[1].Description)
+}
+
+func TestParseTerminators(t *testing.T) {
+	lines := []string{
+		"//   TODO: Cache results",
+		"//   Issue: https://github.com/o/r/issues/1",
+		"//   Use an LRU cache",
+		"//",
+		"//   sized by config",
+		"// End",
+		"// Unrelated doc comment",
+		"func f() {}",
+	}
+
+	tests := []struct {
+		name        string
+		terminators Terminators
+		description []string
+		endLine     int
+	}{
+		{"none", 0, []string{"Use an LRU cache", "sized by config", "End", "Unrelated doc comment"}, 7},
+		{"blank", TerminatorBlankLine, []string{"Use an LRU cache"}, 3},
+		{"end", TerminatorEnd, []string{"Use an LRU cache", "sized by config"}, 5},
+		{"dedent", TerminatorDedent, []string{"Use an LRU cache", "sized by config"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments := parseLines("file.go", GetLanguageForFile("file.go"), lines, tt.terminators)
+			assert.Len(t, comments, 1)
+			assert.Equal(t, "https://github.com/o/r/issues/1", comments[0].IssueURL)
+			assert.Equal(t, tt.description, comments[0].Description)
+			assert.Equal(t, tt.endLine, comments[0].EndLine)
+		})
+	}
+
+	terminators, err := ParseTerminators("blank, End")
+	assert.NoError(t, err)
+	assert.Equal(t, TerminatorBlankLine|TerminatorEnd, terminators)
+
+	terminators, err = ParseTerminators("none")
+	assert.NoError(t, err)
+	assert.Zero(t, terminators)
+
+	_, err = ParseTerminators("eof")
+	assert.Error(t, err)
+}
+
+func TestParseOwnerAndReferenceMarkers(t *testing.T) {
+	lines := []string{
+		"// TODO(alice): Assigned puzzle",
+		"x := 1",
+		"// TODO(#123): Puzzle with an issue",
+		"x := 2",
+		"// TODO(org/repo#4): Puzzle with an issue elsewhere",
+		"x := 3",
+		"// TODO: Plain puzzle",
+	}
+
+	comments := parseLines("file.go", GetLanguageForFile("file.go"), lines, 0)
+	assert.Len(t, comments, 4)
+	assert.Equal(t, "Assigned puzzle", comments[0].Title)
+	assert.Equal(t, "alice", comments[0].Assignee)
+	assert.Empty(t, comments[0].IssueRef)
+	assert.Equal(t, "#123", comments[1].IssueRef)
+	assert.Empty(t, comments[1].Assignee)
+	assert.Equal(t, "org/repo#4", comments[2].IssueRef)
+
+	// Puzzles referencing an issue are never recreated
+	unprocessed := FilterUnprocessedComments(comments)
+	assert.Len(t, unprocessed, 2)
+	assert.Equal(t, "Assigned puzzle", unprocessed[0].Title)
+	assert.Equal(t, "Plain puzzle", unprocessed[1].Title)
+}
+
+func TestParseSuppressionDirectives(t *testing.T) {
+	lines := []string{
+		"// TODO: Intentional note pdd:ignore",
+		"x := 1",
+		"// pdd:disable",
+		"// TODO: Sample puzzle in a fixture",
+		"x := 2",
+		"// pdd:enable",
+		"// TODO: Real puzzle",
+		"// Description",
+		"// pdd:disable",
+	}
+
+	comments := parseLines("file.go", GetLanguageForFile("file.go"), lines, 0)
+	assert.Len(t, comments, 3)
+	assert.Equal(t, "Intentional note", comments[0].Title)
+	assert.True(t, comments[0].Ignored)
+	assert.True(t, comments[1].Ignored)
+	assert.False(t, comments[2].Ignored)
+	assert.Equal(t, []string{"Description"}, comments[2].Description)
+
+	unprocessed := FilterUnprocessedComments(comments)
+	assert.Len(t, unprocessed, 1)
+	assert.Equal(t, "Real puzzle", unprocessed[0].Title)
+
+	// pdd:disable-file near the top ignores every puzzle of the file
+	comments = parseLines("file.py", GetLanguageForFile("file.py"), []string{"# pdd:disable-file", "", "# TODO: Sample"}, 0)
+	assert.Len(t, comments, 1)
+	assert.True(t, comments[0].Ignored)
+}
@@ -0,0 +1,189 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// RedactMode selects what happens to puzzles whose text contains secrets
+type RedactMode string
+
+const (
+	// RedactMask replaces secrets with RedactedText before the puzzle is published
+	RedactMask RedactMode = "mask"
+	// RedactBlock keeps puzzles containing secrets from being published
+	RedactBlock RedactMode = "block"
+	// RedactOff publishes puzzles verbatim
+	RedactOff RedactMode = "off"
+)
+
+// RedactedText replaces secrets in masked puzzles
+const RedactedText = "[REDACTED]"
+
+const (
+	// minEntropyLength is the shortest token checked for high entropy
+	minEntropyLength = 24
+	// minEntropy is the Shannon entropy in bits per character above which a token is a secret
+	minEntropy = 4.0
+)
+
+// secretDetector finds one kind of secret in text
+type secretDetector struct {
+	name  string
+	regex *regexp.Regexp
+}
+
+// builtinDetectors find common credentials and personal data
+var builtinDetectors = []secretDetector{
+	{"AWS access key", regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{"AWS secret key", regexp.MustCompile(`(?i)aws.{0,20}secret.{0,20}[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`)},
+	{"GitHub token", regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,255}|github_pat_[A-Za-z0-9_]{22,255})\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN[A-Z ]* PRIVATE KEY( BLOCK)?-----`)},
+	{"email address", regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`)},
+}
+
+// entropyTokenRegex matches tokens checked for high entropy
+var entropyTokenRegex = regexp.MustCompile(`[A-Za-z0-9+/_=-]{24,}`)
+
+// ParseRedactMode validates a redaction mode name, RedactMask when it is empty
+func ParseRedactMode(value string) (RedactMode, error) {
+	switch mode := RedactMode(strings.ToLower(strings.TrimSpace(value))); mode {
+	case "":
+		return RedactMask, nil
+	case RedactMask, RedactBlock, RedactOff:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown redaction mode: %s", value)
+	}
+}
+
+// Redactor finds secrets and personal data in the text of puzzles before it's published
+type Redactor struct {
+	detectors []secretDetector
+}
+
+// NewRedactor creates a redactor running the built-in detectors and one detector per
+// user supplied regular expression
+func NewRedactor(patterns []string) (*Redactor, error) {
+	detectors := append([]secretDetector(nil), builtinDetectors...)
+	for _, pattern := range patterns {
+		if strings.TrimSpace(pattern) == "" {
+			continue
+		}
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		detectors = append(detectors, secretDetector{name: "pattern " + pattern, regex: regex})
+	}
+	return &Redactor{detectors: detectors}, nil
+}
+
+// Redact masks the secrets in the title and description of a comment. It returns the
+// masked comment and the names of the detectors that found secrets, none when it's clean.
+func (r *Redactor) Redact(comment TodoComment) (TodoComment, []string) {
+	var found []string
+
+	comment.Title = r.redactText(comment.Title, &found)
+	if comment.Description != nil {
+		description := make([]string, len(comment.Description))
+		for i, line := range comment.Description {
+			description[i] = r.redactText(line, &found)
+		}
+		comment.Description = description
+	}
+
+	return comment, found
+}
+
+// Mask returns the comment with the secrets in its title and description masked. A nil
+// redactor returns the comment unchanged.
+func (r *Redactor) Mask(comment TodoComment) TodoComment {
+	if r == nil {
+		return comment
+	}
+	masked, _ := r.Redact(comment)
+	return masked
+}
+
+// redactText masks the secrets in text, adding the names of the detectors that found them to found
+func (r *Redactor) redactText(text string, found *[]string) string {
+	report := func(name string) {
+		if !slices.Contains(*found, name) {
+			*found = append(*found, name)
+		}
+	}
+
+	for _, detector := range r.detectors {
+		if detector.regex.MatchString(text) {
+			report(detector.name)
+			text = detector.regex.ReplaceAllString(text, RedactedText)
+		}
+	}
+
+	return entropyTokenRegex.ReplaceAllStringFunc(text, func(token string) string {
+		if !isHighEntropy(token) {
+			return token
+		}
+		report("high-entropy string")
+		return RedactedText
+	})
+}
+
+// isHighEntropy reports whether a token mixing letters and digits looks random enough to be a secret
+func isHighEntropy(token string) bool {
+	if len(token) < minEntropyLength || !strings.ContainsAny(token, "0123456789") || strings.Trim(token, "0123456789+/_=-") == "" {
+		return false
+	}
+	return shannonEntropy(token) > minEntropy
+}
+
+// shannonEntropy returns the Shannon entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	entropy := 0.0
+	n := float64(len(s))
+	for _, count := range counts {
+		p := float64(count) / n
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// RedactionFinding describes a puzzle whose text contains secrets
+type RedactionFinding struct {
+	Comment   TodoComment
+	Detectors []string
+}
+
+// RedactComments applies the redaction mode to the comments about to be published. It
+// returns the comments to publish, masked in RedactMask mode, and the comments in which
+// secrets were found. In RedactBlock mode these are left out of the comments to publish.
+func RedactComments(comments []TodoComment, redactor *Redactor, mode RedactMode) ([]TodoComment, []RedactionFinding) {
+	if mode == RedactOff || redactor == nil {
+		return comments, nil
+	}
+
+	publish := make([]TodoComment, 0, len(comments))
+	var findings []RedactionFinding
+	for _, comment := range comments {
+		masked, found := redactor.Redact(comment)
+		if len(found) == 0 {
+			publish = append(publish, comment)
+			continue
+		}
+
+		findings = append(findings, RedactionFinding{Comment: comment, Detectors: found})
+		if mode == RedactMask {
+			publish = append(publish, masked)
+		}
+	}
+	return publish, findings
+}
@@ -0,0 +1,161 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// RetryManifestVersion is the version of the retry manifest file schema
+const RetryManifestVersion = 1
+
+// DefaultRetryPath is the default location of the retry manifest in the workspace
+const DefaultRetryPath = ".pdd/retry.json"
+
+// RetryEntry is a puzzle whose issue was created but whose TODO comment couldn't be
+// updated with the issue reference
+type RetryEntry struct {
+	Fingerprint string    `json:"fingerprint"`
+	IssueURL    string    `json:"issue_url"`
+	FilePath    string    `json:"file"`
+	Cell        int       `json:"cell,omitempty"`
+	LineNumber  int       `json:"line"`
+	Title       string    `json:"title"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error"`
+	FailedAt    time.Time `json:"failed_at"`
+}
+
+// RetryQueue holds the failed write-backs of a run, retried first by the next run
+type RetryQueue []RetryEntry
+
+// RetryManifest is the file persisting the retry queue between runs when there is no ledger
+type RetryManifest struct {
+	Version int        `json:"version"`
+	Entries RetryQueue `json:"entries"`
+}
+
+// Add queues the write-back of comment that failed with err, counting the attempts of a
+// write-back that was already queued by previous runs
+func (q *RetryQueue) Add(comment TodoComment, err error, previous RetryQueue, now time.Time) {
+	fingerprint := comment.Fingerprint()
+	attempts := 1
+	for _, entry := range previous {
+		if entry.Fingerprint == fingerprint {
+			attempts = entry.Attempts + 1
+			break
+		}
+	}
+
+	*q = append(*q, RetryEntry{
+		Fingerprint: fingerprint,
+		IssueURL:    comment.IssueURL,
+		FilePath:    comment.FilePath,
+		Cell:        comment.Cell,
+		LineNumber:  comment.LineNumber,
+		Title:       comment.Title,
+		Attempts:    attempts,
+		LastError:   err.Error(),
+		FailedAt:    now,
+	})
+}
+
+// Take matches the queued write-backs against scanned comments. Each queued write-back is
+// matched with at most one puzzle that still lacks an issue reference: the one with its
+// fingerprint or else the nearest one with its title. The matched comments get the issue URL
+// back and are returned as the write-backs to retry. Queued puzzles that were removed from
+// the code or whose issue is referenced in the code again are dropped.
+func (q RetryQueue) Take(comments []TodoComment) ([]TodoComment, []TodoComment) {
+	if len(q) == 0 {
+		return comments, nil
+	}
+
+	comments = slices.Clone(comments)
+	referenced := make(map[string]bool, len(comments))
+	for _, comment := range comments {
+		if comment.IssueURL != "" {
+			referenced[comment.IssueURL] = true
+		}
+	}
+
+	taken := make([]bool, len(comments))
+	var retry []TodoComment
+	for _, entry := range q {
+		if referenced[entry.IssueURL] {
+			continue
+		}
+
+		match := -1
+		for i, comment := range comments {
+			if taken[i] || comment.IssueURL != "" || comment.IssueRef != "" || !comment.sameTitle(entry.comment()) {
+				continue
+			}
+			if match < 0 || entry.prefers(comment, comments[match]) {
+				match = i
+			}
+		}
+		if match < 0 {
+			continue
+		}
+
+		taken[match] = true
+		comments[match].IssueURL = entry.IssueURL
+		retry = append(retry, comments[match])
+	}
+	return comments, retry
+}
+
+// comment returns the puzzle of the queued write-back at its location when it failed
+func (e RetryEntry) comment() TodoComment {
+	return TodoComment{FilePath: e.FilePath, Cell: e.Cell, LineNumber: e.LineNumber, Title: e.Title}
+}
+
+// prefers reports whether a is a better match than b for the queued write-back: the puzzle
+// with its fingerprint, otherwise the one nearest to where the write-back failed
+func (e RetryEntry) prefers(a, b TodoComment) bool {
+	if exactA, exactB := a.Fingerprint() == e.Fingerprint, b.Fingerprint() == e.Fingerprint; exactA != exactB {
+		return exactA
+	}
+	if da, db := abs(a.Cell-e.Cell), abs(b.Cell-e.Cell); da != db {
+		return da < db
+	}
+	return abs(a.LineNumber-e.LineNumber) < abs(b.LineNumber-e.LineNumber)
+}
+
+// LoadRetryManifest reads the retry queue from a manifest file, a missing file yields an empty queue
+func LoadRetryManifest(path string) (RetryQueue, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read retry manifest %s: %w", path, err)
+	}
+
+	var manifest RetryManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse retry manifest %s: %w", path, err)
+	}
+	if manifest.Version > RetryManifestVersion {
+		return nil, fmt.Errorf("unsupported retry manifest version %d", manifest.Version)
+	}
+	return manifest.Entries, nil
+}
+
+// SaveRetryManifest writes the retry queue to a manifest file, removing the file when the queue is empty
+func SaveRetryManifest(path string, queue RetryQueue) error {
+	if len(queue) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove retry manifest %s: %w", path, err)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(RetryManifest{Version: RetryManifestVersion, Entries: queue}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize retry manifest: %w", err)
+	}
+	return writeFileAtomic(path, append(data, '\n'))
+}
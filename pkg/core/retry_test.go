@@ -0,0 +1,116 @@
+package core
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryQueue(t *testing.T) {
+	now := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	failed := TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Retry me", IssueURL: "https://github.com/o/r/issues/7"}
+
+	var queue RetryQueue
+	queue.Add(failed, errors.New("conflict"), nil, now)
+	require.Len(t, queue, 1)
+	assert.Equal(t, 1, queue[0].Attempts)
+	assert.Equal(t, "conflict", queue[0].LastError)
+
+	// Failing again counts the attempts of previous runs
+	var next RetryQueue
+	next.Add(failed, errors.New("conflict"), queue, now)
+	assert.Equal(t, 2, next[0].Attempts)
+
+	scanned := []TodoComment{
+		{FilePath: "main.go", LineNumber: 5, Title: "Retry me"},
+		{FilePath: "main.go", LineNumber: 9, Title: "New puzzle"},
+	}
+	comments, retry := queue.Take(scanned)
+	require.Len(t, retry, 1)
+	assert.Equal(t, 5, retry[0].LineNumber, "the current location of the puzzle should be used")
+	assert.Equal(t, failed.IssueURL, retry[0].IssueURL)
+	assert.Equal(t, failed.IssueURL, comments[0].IssueURL)
+	assert.Empty(t, comments[1].IssueURL)
+	assert.Empty(t, scanned[0].IssueURL, "scanned comments should not be modified")
+
+	// Puzzles that reference an issue again are not retried
+	scanned[0].IssueURL = "https://github.com/o/r/issues/8"
+	_, retry = queue.Take(scanned)
+	assert.Empty(t, retry)
+
+	// Nor are write-backs whose issue is referenced in the code again
+	scanned[0].IssueURL = ""
+	scanned[1].IssueURL = failed.IssueURL
+	_, retry = queue.Take(scanned)
+	assert.Empty(t, retry)
+}
+
+func TestRetryQueueSameTitle(t *testing.T) {
+	scanned := []TodoComment{
+		{FilePath: "main.go", LineNumber: 3, Title: "Add tests"},
+		{FilePath: "main.go", LineNumber: 9, Title: "Add tests", Occurrence: 1},
+		{FilePath: "main.go", LineNumber: 15, Title: "Add tests", Occurrence: 2},
+	}
+
+	var queue RetryQueue
+	queue.Add(TodoComment{FilePath: "main.go", LineNumber: 10, Title: "Add tests", Occurrence: 1, IssueURL: "https://github.com/o/r/issues/7"}, errors.New("conflict"), nil, time.Now())
+
+	// Each queued write-back is applied to a single puzzle, the one with its fingerprint
+	comments, retry := queue.Take(scanned)
+	require.Len(t, retry, 1)
+	assert.Equal(t, 9, retry[0].LineNumber)
+	assert.Empty(t, comments[0].IssueURL)
+	assert.Empty(t, comments[2].IssueURL)
+
+	// Without it, the nearest puzzle with the title is used
+	scanned[1].IssueURL = "https://github.com/o/r/issues/8"
+	_, retry = queue.Take(scanned)
+	require.Len(t, retry, 1)
+	assert.Equal(t, 15, retry[0].LineNumber)
+}
+
+func TestRetryManifestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".pdd", "retry.json")
+
+	queue, err := LoadRetryManifest(path)
+	require.NoError(t, err)
+	assert.Empty(t, queue)
+
+	queue.Add(TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Retry me"}, errors.New("conflict"), nil, time.Now().UTC().Truncate(time.Second))
+	require.NoError(t, SaveRetryManifest(path, queue))
+
+	loaded, err := LoadRetryManifest(path)
+	require.NoError(t, err)
+	assert.Equal(t, queue, loaded)
+
+	// An empty queue removes the manifest
+	require.NoError(t, SaveRetryManifest(path, nil))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"version": 99}`), 0o600))
+	_, err = LoadRetryManifest(path)
+	assert.Error(t, err)
+}
+
+func TestLedgerRetriesAndForget(t *testing.T) {
+	ledger := NewLedger()
+	comment := TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Orphan", IssueURL: "https://github.com/o/r/issues/7"}
+	ledger.Record(comment, time.Now())
+	ledger.Retries.Add(comment, errors.New("conflict"), nil, time.Now().UTC().Truncate(time.Second))
+
+	data, err := MarshalLedger(ledger)
+	require.NoError(t, err)
+	loaded, err := UnmarshalLedger(data)
+	require.NoError(t, err)
+	assert.Equal(t, ledger.Retries, loaded.Retries)
+
+	ledger.Forget(comment.Fingerprint())
+	_, ok := ledger.Lookup(comment.Fingerprint())
+	assert.False(t, ok)
+}
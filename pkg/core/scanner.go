@@ -0,0 +1,295 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// DefaultMaxFileSize is the size above which files are skipped without being read
+	DefaultMaxFileSize = 5 << 20
+
+	// sniffSize is how much of a file is inspected to detect binary content
+	sniffSize = 8000
+)
+
+// ErrInvalidContent is wrapped by the errors of files whose content can't be decoded or
+// parsed, such as a truncated notebook or odd-length UTF-16. Directory scans skip these files
+// with a warning.
+var ErrInvalidContent = errors.New("invalid content")
+
+// ScanOptions configures a directory scan
+type ScanOptions struct {
+	// ExcludeDirs are directories skipped with their content
+	ExcludeDirs []string
+	// Workers is the number of files parsed concurrently, runtime.NumCPU() when zero
+	Workers int
+	// MaxFileSize is the size in bytes above which files are skipped, DefaultMaxFileSize
+	// when zero and no limit when negative
+	MaxFileSize int64
+	// Terminators are the comment lines that end a puzzle before the end of its comment
+	Terminators Terminators
+}
+
+// ScanResult holds the TODO comments found in a file or the error that occurred scanning it
+type ScanResult struct {
+	Path     string
+	Comments []TodoComment
+	Err      error
+}
+
+// StreamDirectory recursively scans a directory for TODO comments, parsing files with a
+// pool of workers. Results are sent to the returned channel as files are parsed, in no
+// particular order, and the channel is closed when the scan completes or ctx is cancelled.
+// Files in unsupported languages, larger than the size limit or with binary content are
+// skipped before they are read, and files whose content can't be parsed are skipped with a warning.
+func StreamDirectory(ctx context.Context, dir string, opts ScanOptions) <-chan ScanResult {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	maxSize := opts.MaxFileSize
+	if maxSize == 0 {
+		maxSize = DefaultMaxFileSize
+	}
+
+	paths := make(chan string, workers)
+	results := make(chan ScanResult, workers)
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				comments, err := parseFile(path, opts.Terminators)
+				if errors.Is(err, ErrInvalidContent) {
+					// A malformed file, such as a git-lfs pointer or a merge-conflicted notebook, doesn't stop the scan
+					slog.Warn("Skipping file that can't be parsed", "path", path, "error", err)
+					continue
+				}
+				if err == nil && len(comments) == 0 {
+					continue
+				}
+				select {
+				case results <- ScanResult{Path: path, Comments: comments, Err: err}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(results)
+		defer wg.Wait()
+		defer close(paths)
+
+		err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Skip excluded directories
+			if d.IsDir() {
+				for _, excludeDir := range opts.ExcludeDirs {
+					if strings.HasPrefix(path, excludeDir) {
+						return filepath.SkipDir
+					}
+				}
+				return nil
+			}
+
+			// Files without an extension may be scripts identified by their shebang or modeline
+			if !d.Type().IsRegular() || (GetLanguageForFile(path) == nil && filepath.Ext(path) != "" && !isNotebook(path)) {
+				return nil
+			}
+
+			if maxSize > 0 {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				if info.Size() > maxSize {
+					return nil
+				}
+			}
+
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil {
+			select {
+			case results <- ScanResult{Path: dir, Err: err}:
+			case <-ctx.Done():
+			}
+		}
+	}()
+
+	return results
+}
+
+// ScanDirectoryWithOptions recursively scans a directory for TODO comments and returns
+// them sorted by file and line. The scan stops at the first error.
+func ScanDirectoryWithOptions(ctx context.Context, dir string, opts ScanOptions) ([]TodoComment, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var allComments []TodoComment
+	results := StreamDirectory(ctx, dir, opts)
+	for result := range results {
+		if result.Err != nil {
+			// Stop the scan and wait for the workers to finish
+			cancel()
+			for range results {
+			}
+			return nil, result.Err
+		}
+		allComments = append(allComments, result.Comments...)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	SortComments(allComments)
+	return allComments, nil
+}
+
+// ScanDirectory recursively scans a directory for TODO comments
+func ScanDirectory(dir string, excludeDirs []string) ([]TodoComment, error) {
+	return ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{ExcludeDirs: excludeDirs})
+}
+
+// SortComments sorts comments by file path, notebook cell and line number
+func SortComments(comments []TodoComment) {
+	sort.SliceStable(comments, func(i, j int) bool {
+		if comments[i].FilePath != comments[j].FilePath {
+			return comments[i].FilePath < comments[j].FilePath
+		}
+		if comments[i].Cell != comments[j].Cell {
+			return comments[i].Cell < comments[j].Cell
+		}
+		return comments[i].LineNumber < comments[j].LineNumber
+	})
+}
+
+// parseFile parses a file for TODO comments unless its content looks binary. The language
+// is detected from the file name, shebang line and modelines.
+func parseFile(path string, terminators Terminators) ([]TodoComment, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, sniffSize)
+	if isBinary(reader) {
+		return nil, nil
+	}
+
+	// Avoid reading files that cannot be identified by name unless they have a shebang or modeline
+	if !isNotebook(path) && GetLanguageForFile(path) == nil && !hasShebangOrModeline(reader) && !hasTrailingModeline(file) {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseContent(path, data, terminators)
+}
+
+// parseContent parses the TODO comments in the content of the file at path, numbering
+// the occurrences of puzzles sharing a title
+func parseContent(path string, data []byte, terminators Terminators) ([]TodoComment, error) {
+	comments, err := parseComments(path, data, terminators)
+	numberOccurrences(comments)
+	return comments, err
+}
+
+// parseComments parses the TODO comments in the content of the file at path in its language
+func parseComments(path string, data []byte, terminators Terminators) ([]TodoComment, error) {
+	if isNotebook(path) {
+		return parseNotebook(path, data, terminators)
+	}
+
+	text, err := DecodeText(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w: %w", path, ErrInvalidContent, err)
+	}
+
+	lang := DetectLanguage(path, text.Lines)
+	if lang == nil {
+		return nil, nil // Unsupported file type
+	}
+
+	if lang.Name == "Go" {
+		return parseGoSource(path, []byte(strings.Join(text.Lines, "\n")), text.Lines, terminators), nil
+	}
+
+	return parseLines(path, lang, text.Lines, terminators), nil
+}
+
+// hasShebangOrModeline reports whether the start of the content has a shebang line or a
+// modeline. Content shorter than sniffSize is inspected whole, so modelines at its end count.
+func hasShebangOrModeline(r *bufio.Reader) bool {
+	head, _ := r.Peek(sniffSize)
+	if bytes.HasPrefix(head, []byte("#!")) {
+		return true
+	}
+
+	text, err := DecodeText(head)
+	if err != nil {
+		return false
+	}
+	return languageFromModeline(text.Lines) != nil
+}
+
+// hasTrailingModeline reports whether the last lines of a file larger than sniffSize have a
+// modeline, which Vim and Emacs also honor at the end of a file. The file offset is left as is.
+func hasTrailingModeline(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || info.Size() <= sniffSize {
+		return false // Smaller files were inspected whole by hasShebangOrModeline
+	}
+
+	tail := make([]byte, sniffSize)
+	n, err := file.ReadAt(tail, info.Size()-sniffSize)
+	if err != nil && err != io.EOF {
+		return false
+	}
+
+	text, err := DecodeText(tail[:n])
+	if err != nil {
+		return false
+	}
+	return languageFromModeline(text.Lines[max(len(text.Lines)-modelineLines, 0):]) != nil
+}
+
+// isBinary reports whether the start of the content contains a NUL byte. UTF-16 content
+// marked with a byte order mark is treated as text.
+func isBinary(r *bufio.Reader) bool {
+	head, _ := r.Peek(sniffSize)
+	return !hasUTF16BOM(head) && bytes.IndexByte(head, 0) >= 0
+}
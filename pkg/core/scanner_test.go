@@ -0,0 +1,193 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeFiles creates files with the given content relative to dir
+func writeFiles(t testing.TB, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestScanDirectoryWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"b.go":                  "package b\n\n// TODO: Second file\n",
+		"a.go":                  "package a\n\n// TODO: First\n\nfunc f() {}\n\n// TODO: Second\n",
+		"sub/c.py":              "# TODO: Python task\n",
+		"vendor/dep.go":         "// TODO: Vendored\n",
+		"notes.xyz":             "// TODO: Unsupported\n",
+		"large.go":              "// TODO: Too large\n" + strings.Repeat("//\n", 100),
+		"binary.go":             "// TODO: Binary\n\x00\x01",
+		"node_modules/pkg/x.js": "// TODO: Dependency\n",
+	})
+
+	comments, err := ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{
+		ExcludeDirs: []string{filepath.Join(dir, "vendor"), filepath.Join(dir, "node_modules")},
+		Workers:     3,
+		MaxFileSize: 200,
+	})
+	require.NoError(t, err)
+
+	var got []string
+	for _, comment := range comments {
+		rel, err := filepath.Rel(dir, comment.FilePath)
+		require.NoError(t, err)
+		got = append(got, fmt.Sprintf("%s:%d %s", filepath.ToSlash(rel), comment.LineNumber, comment.Title))
+	}
+
+	assert.Equal(t, []string{
+		"a.go:3 First",
+		"a.go:7 Second",
+		"b.go:3 Second file",
+		"sub/c.py:1 Python task",
+	}, got)
+}
+
+func TestScanDirectoryModelines(t *testing.T) {
+	dir := t.TempDir()
+	padding := strings.Repeat("x = 1\n", 2*sniffSize/len("x = 1\n"))
+	writeFiles(t, dir, map[string]string{
+		"leading":  "# vim: set ft=python:\n# TODO: Leading modeline\n" + padding,
+		"trailing": "# TODO: Trailing modeline\n" + padding + "# vim: set ft=python:\n",
+		"middle":   "# TODO: No modeline\n" + padding + "# vim: set ft=python:\n" + padding,
+	})
+
+	comments, err := ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{})
+	require.NoError(t, err)
+
+	var got []string
+	for _, comment := range comments {
+		got = append(got, filepath.Base(comment.FilePath)+" "+comment.Title)
+	}
+	assert.Equal(t, []string{"leading Leading modeline", "trailing Trailing modeline"}, got)
+}
+
+func TestScanDirectorySkipsInvalidNotebooks(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"main.go":         "package main\n\n// TODO: Still found\n",
+		"lfs.ipynb":       "version https://git-lfs.github.com/spec/v1\noid sha256:4d7a\nsize 12345\n",
+		"truncated.ipynb": `{"cells": [{"cell_type": "code", "source": ["# TODO: Lost`,
+	})
+
+	comments, err := ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Still found", comments[0].Title)
+
+	_, err = parseFile(filepath.Join(dir, "lfs.ipynb"), 0)
+	assert.ErrorIs(t, err, ErrInvalidContent)
+}
+
+func TestScanDirectorySkipsUndecodableFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"valid.py": "# TODO: Still found\n",
+		// A UTF-16 byte order mark followed by a stray byte
+		"broken.py": "\xff\xfe#\x00 \x00T\x00O\x00D\x00O\x00:\x00 \x00L\x00o\x00s\x00t\x00\n",
+	})
+
+	comments, err := ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{})
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Still found", comments[0].Title)
+
+	_, err = parseFile(filepath.Join(dir, "broken.py"), 0)
+	assert.ErrorIs(t, err, ErrInvalidContent)
+}
+
+func TestScanDirectoryWithOptionsNoSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"large.go": "// TODO: Large\n" + strings.Repeat("//\n", DefaultMaxFileSize/3),
+	})
+
+	comments, err := ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, comments, "files above the default limit should be skipped")
+
+	comments, err = ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{MaxFileSize: -1})
+	require.NoError(t, err)
+	assert.Len(t, comments, 1)
+}
+
+func TestScanDirectoryWithOptionsCancelled(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.go": "// TODO: Task\n"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := ScanDirectoryWithOptions(ctx, dir, ScanOptions{})
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestScanDirectoryMissingDir(t *testing.T) {
+	_, err := ScanDirectory(filepath.Join(t.TempDir(), "missing"), nil)
+	assert.Error(t, err)
+}
+
+// benchmarkTreeSize is the number of files in the synthetic tree used by the scan benchmarks
+const benchmarkTreeSize = 100_000
+
+// createBenchmarkTree creates a synthetic tree of source files, one in ten containing a TODO
+func createBenchmarkTree(b *testing.B) string {
+	b.Helper()
+
+	dir := b.TempDir()
+	for i := range benchmarkTreeSize {
+		sub := filepath.Join(dir, fmt.Sprintf("pkg%03d", i%1000))
+		if i < 1000 {
+			require.NoError(b, os.MkdirAll(sub, 0755))
+		}
+
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "package pkg%03d\n\n", i%1000)
+		if i%10 == 0 {
+			fmt.Fprintf(&sb, "// TODO: Puzzle %d\n// Labels: bench\n// Description of puzzle %d\n", i, i)
+		}
+		for j := range 20 {
+			fmt.Fprintf(&sb, "func f%d() int { return %d }\n", j, j)
+		}
+
+		require.NoError(b, os.WriteFile(filepath.Join(sub, fmt.Sprintf("file%d.go", i)), []byte(sb.String()), 0644))
+	}
+	return dir
+}
+
+func BenchmarkScanDirectory(b *testing.B) {
+	dir := createBenchmarkTree(b)
+
+	for _, workers := range []int{1, 4, 0} {
+		name := fmt.Sprintf("workers=%d", workers)
+		if workers == 0 {
+			name = "workers=NumCPU"
+		}
+
+		b.Run(name, func(b *testing.B) {
+			for b.Loop() {
+				comments, err := ScanDirectoryWithOptions(context.Background(), dir, ScanOptions{Workers: workers})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(comments) != benchmarkTreeSize/10 {
+					b.Fatalf("expected %d comments, got %d", benchmarkTreeSize/10, len(comments))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the character encoding of a text file
+type Encoding int
+
+const (
+	EncodingUTF8 Encoding = iota
+	EncodingUTF16LE
+	EncodingUTF16BE
+	// EncodingLatin1 is used for content that is not valid UTF-8, every byte maps to one character
+	EncodingLatin1
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// TextFile is the decoded content of a text file split into lines. It keeps the encoding,
+// byte order mark and line endings so the content can be written back byte for byte
+// except for the lines that were changed.
+type TextFile struct {
+	// Lines are the decoded lines without line terminators
+	Lines []string
+	// Encoding is the character encoding of the file
+	Encoding Encoding
+	// BOM is set when the file starts with a byte order mark
+	BOM bool
+
+	// endings holds the terminator of every line, empty for a last line without one
+	endings []string
+}
+
+// DecodeText decodes file content into lines, detecting the encoding from the byte order mark
+// and falling back to Latin-1 for content that is not valid UTF-8
+func DecodeText(data []byte) (*TextFile, error) {
+	f := &TextFile{}
+
+	var text string
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		f.BOM = true
+		text = string(data[len(bomUTF8):])
+	case bytes.HasPrefix(data, bomUTF16LE):
+		f.BOM = true
+		f.Encoding = EncodingUTF16LE
+		decoded, err := decodeUTF16(data[len(bomUTF16LE):], binary.LittleEndian)
+		if err != nil {
+			return nil, err
+		}
+		text = decoded
+	case bytes.HasPrefix(data, bomUTF16BE):
+		f.BOM = true
+		f.Encoding = EncodingUTF16BE
+		decoded, err := decodeUTF16(data[len(bomUTF16BE):], binary.BigEndian)
+		if err != nil {
+			return nil, err
+		}
+		text = decoded
+	case utf8.Valid(data):
+		text = string(data)
+	default:
+		f.Encoding = EncodingLatin1
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		text = string(runes)
+	}
+
+	for len(text) > 0 {
+		i := strings.IndexByte(text, '\n')
+		if i < 0 {
+			f.Lines = append(f.Lines, text)
+			f.endings = append(f.endings, "")
+			break
+		}
+
+		line, ending := text[:i], "\n"
+		if strings.HasSuffix(line, "\r") {
+			line, ending = line[:len(line)-1], "\r\n"
+		}
+		f.Lines = append(f.Lines, line)
+		f.endings = append(f.endings, ending)
+		text = text[i+1:]
+	}
+
+	return f, nil
+}
+
+// LineEnding returns the line terminator used by most lines of the file, "\n" by default
+func (f *TextFile) LineEnding() string {
+	crlf, lf := 0, 0
+	for _, ending := range f.endings {
+		switch ending {
+		case "\r\n":
+			crlf++
+		case "\n":
+			lf++
+		}
+	}
+	if crlf > lf {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// TrailingNewline reports whether the last line of the file is terminated
+func (f *TextFile) TrailingNewline() bool {
+	return len(f.endings) > 0 && f.endings[len(f.endings)-1] != ""
+}
+
+// InsertLine inserts a line after the line with the given zero-based index, or at the
+// start of the file when index is -1. The new line uses the terminator of its neighbour.
+func (f *TextFile) InsertLine(index int, line string) error {
+	if index < -1 || index >= len(f.Lines) {
+		return fmt.Errorf("line index %d is out of range", index)
+	}
+
+	ending := f.LineEnding()
+	if index >= 0 && f.endings[index] != "" {
+		ending = f.endings[index]
+	}
+
+	pos := index + 1
+	f.Lines = append(f.Lines[:pos], append([]string{line}, f.Lines[pos:]...)...)
+
+	if index >= 0 && f.endings[index] == "" {
+		// Appending after an unterminated last line: terminate it and keep the new line unterminated
+		f.endings[index] = ending
+		f.endings = append(f.endings, "")
+	} else {
+		f.endings = append(f.endings[:pos], append([]string{ending}, f.endings[pos:]...)...)
+	}
+
+	return nil
+}
+
+// ReplaceLine replaces the line with the given zero-based index keeping its terminator
+func (f *TextFile) ReplaceLine(index int, line string) error {
+	if index < 0 || index >= len(f.Lines) {
+		return fmt.Errorf("line index %d is out of range", index)
+	}
+	f.Lines[index] = line
+	return nil
+}
+
+// Encode encodes the lines back into file content with the original encoding, byte order mark and line endings
+func (f *TextFile) Encode() []byte {
+	var sb strings.Builder
+	for i, line := range f.Lines {
+		sb.WriteString(line)
+		sb.WriteString(f.endings[i])
+	}
+	text := sb.String()
+
+	var buf bytes.Buffer
+	switch f.Encoding {
+	case EncodingUTF16LE, EncodingUTF16BE:
+		order, bom := binary.AppendByteOrder(binary.LittleEndian), bomUTF16LE
+		if f.Encoding == EncodingUTF16BE {
+			order, bom = binary.BigEndian, bomUTF16BE
+		}
+		if f.BOM {
+			buf.Write(bom)
+		}
+		for _, unit := range utf16.Encode([]rune(text)) {
+			buf.Write(order.AppendUint16(nil, unit))
+		}
+	case EncodingLatin1:
+		for _, r := range text {
+			if r > 0xFF {
+				r = '?'
+			}
+			buf.WriteByte(byte(r))
+		}
+	default:
+		if f.BOM {
+			buf.Write(bomUTF8)
+		}
+		buf.WriteString(text)
+	}
+
+	return buf.Bytes()
+}
+
+// decodeUTF16 decodes UTF-16 content in the given byte order
+func decodeUTF16(data []byte, order binary.ByteOrder) (string, error) {
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("invalid UTF-16 content: odd number of bytes")
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// hasUTF16BOM reports whether the content starts with a UTF-16 byte order mark
+func hasUTF16BOM(data []byte) bool {
+	return bytes.HasPrefix(data, bomUTF16LE) || bytes.HasPrefix(data, bomUTF16BE)
+}
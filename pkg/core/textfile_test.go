@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeUTF16LE encodes s as UTF-16LE with a byte order mark
+func encodeUTF16LE(s string) []byte {
+	buf := bytes.NewBuffer([]byte{0xFF, 0xFE})
+	for _, unit := range utf16.Encode([]rune(s)) {
+		buf.Write([]byte{byte(unit), byte(unit >> 8)})
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeTextRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding Encoding
+		lines    []string
+	}{
+		{name: "lf", data: []byte("a\nb\n"), lines: []string{"a", "b"}},
+		{name: "crlf", data: []byte("a\r\nb\r\n"), lines: []string{"a", "b"}},
+		{name: "mixed endings", data: []byte("a\r\nb\nc"), lines: []string{"a", "b", "c"}},
+		{name: "utf-8 bom", data: []byte("\xEF\xBB\xBFa\nb"), lines: []string{"a", "b"}},
+		{name: "utf-16le", data: encodeUTF16LE("a\r\nü\r\n"), encoding: EncodingUTF16LE, lines: []string{"a", "ü"}},
+		{name: "utf-16be", data: []byte{0xFE, 0xFF, 0, 'a', 0, '\n', 0, 'b'}, encoding: EncodingUTF16BE, lines: []string{"a", "b"}},
+		{name: "latin-1", data: []byte("caf\xE9\n"), encoding: EncodingLatin1, lines: []string{"café"}},
+		{name: "empty", data: []byte{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := DecodeText(tt.data)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.encoding, text.Encoding)
+			assert.Equal(t, tt.lines, text.Lines)
+			assert.Equal(t, string(tt.data), string(text.Encode()), "unchanged content should be written back byte for byte")
+		})
+	}
+}
+
+func TestDecodeTextInvalidUTF16(t *testing.T) {
+	_, err := DecodeText([]byte{0xFF, 0xFE, 'a'})
+	assert.Error(t, err)
+}
+
+func TestTextFileInsertLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		index int
+		want  string
+	}{
+		{name: "lf", data: "a\nb\n", index: 0, want: "a\nx\nb\n"},
+		{name: "crlf", data: "a\r\nb\r\n", index: 0, want: "a\r\nx\r\nb\r\n"},
+		{name: "after last terminated line", data: "a\r\nb\r\n", index: 1, want: "a\r\nb\r\nx\r\n"},
+		{name: "after last unterminated line", data: "a\r\nb", index: 1, want: "a\r\nb\r\nx"},
+		{name: "at start", data: "a\n", index: -1, want: "x\na\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := DecodeText([]byte(tt.data))
+			require.NoError(t, err)
+
+			require.NoError(t, text.InsertLine(tt.index, "x"))
+			assert.Equal(t, tt.want, string(text.Encode()))
+		})
+	}
+
+	text, err := DecodeText([]byte("a\n"))
+	require.NoError(t, err)
+	assert.Error(t, text.InsertLine(1, "x"))
+}
+
+func TestParseLongLinesAndEncodings(t *testing.T) {
+	longLine := "var x = \"" + strings.Repeat("a", 200_000) + "\""
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "long lines", data: []byte(longLine + "\n// TODO: Task\n// Description\n" + longLine + "\n")},
+		{name: "crlf", data: []byte("package a\r\n// TODO: Task\r\n// Description\r\n")},
+		{name: "utf-8 bom", data: []byte("\xEF\xBB\xBF// x\n// TODO: Task\n// Description\n")},
+		{name: "utf-16le", data: encodeUTF16LE("package a\r\n// TODO: Task\r\n// Description\r\n")},
+		{name: "latin-1", data: []byte("// caf\xE9\n// TODO: Task\n// Description\n")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comments, err := parseReader("file.go", GetLanguageForFile("file.go"), bytes.NewReader(tt.data))
+			require.NoError(t, err)
+			require.Len(t, comments, 1)
+
+			assert.Equal(t, 2, comments[0].LineNumber)
+			assert.Equal(t, "Task", comments[0].Title)
+			assert.Equal(t, []string{"Description"}, comments[0].Description)
+		})
+	}
+}
+
+func TestIsBinaryAllowsUTF16(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.go": string(encodeUTF16LE("// TODO: Wide\n"))})
+
+	comments, err := ScanDirectory(dir, nil)
+	require.NoError(t, err)
+	require.Len(t, comments, 1)
+	assert.Equal(t, "Wide", comments[0].Title)
+}
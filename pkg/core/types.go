@@ -1,18 +1,86 @@
 package core
 
+import (
+	"fmt"
+	"path"
+)
+
 // TodoComment represents a parsed TODO comment from code
 type TodoComment struct {
 	FilePath    string
+	Cell        int // One-based cell index in Jupyter notebooks, 0 in other files
 	LineNumber  int
+	EndLine     int
 	Title       string
 	Description []string
 	Labels      []string
 	IssueURL    string
+	// IssueRef is the issue referenced by a TODO(#123) or TODO(owner/repo#123) marker
+	IssueRef string
+	// Assignee is the user named by a TODO(username) marker
+	Assignee string
+	// Ignored is set for puzzles suppressed by pdd:ignore, pdd:disable or pdd:disable-file,
+	// which never become issues but are still reported
+	Ignored bool
+	// Symbol is the declaration enclosing the comment, such as (*Client).Update, in languages that report it
+	Symbol string
+	// Occurrence is the zero-based index of the puzzle among the puzzles with the same title in its file
+	Occurrence int
+}
+
+// Position returns the line of the comment, prefixed with its cell in notebooks
+func (c TodoComment) Position() string {
+	if c.Cell > 0 {
+		return fmt.Sprintf("cell %d, line %d", c.Cell, c.LineNumber)
+	}
+	return fmt.Sprintf("line %d", c.LineNumber)
+}
+
+// Location returns the file and position of the comment such as "main.go:12"
+func (c TodoComment) Location() string {
+	if c.Cell > 0 {
+		return fmt.Sprintf("%s:cell%d:%d", c.FilePath, c.Cell, c.LineNumber)
+	}
+	return fmt.Sprintf("%s:%d", c.FilePath, c.LineNumber)
 }
 
 // Config represents the GitHub Action configuration
 type Config struct {
-	GitHubToken      string
-	BranchName       string
-	IssueTitlePrefix string
+	GitHubToken       string
+	AppID             int64
+	AppPrivateKey     string
+	AppInstallation   int64
+	BranchName        string
+	IssueTitlePrefix  string
+	APIURL            string
+	ServerURL         string
+	Concurrency       int
+	MaxFileSize       int64
+	Terminators       Terminators
+	IssueReference    ReferenceStyle
+	IssueAfterLabels  bool
+	CheckConclusion   string
+	LedgerMode        string
+	LedgerPath        string
+	LedgerBranch      string
+	ExportFormat      string
+	ExportPath        string
+	RedactMode        RedactMode
+	RedactPatterns    []string
+	FailOn            FailPolicy
+	Compensate        bool
+	RetryPath         string
+	WriteBackAttempts int
+}
+
+// QualifiedSymbol returns the enclosing declaration qualified by the directory of the file,
+// such as pkg/github.(*Client).Update, or an empty string when it is unknown
+func (c TodoComment) QualifiedSymbol() string {
+	if c.Symbol == "" {
+		return ""
+	}
+	if dir := path.Dir(c.FilePath); dir != "." && dir != "/" {
+		return dir + "." + c.Symbol
+	}
+	return c.Symbol
 }
@@ -0,0 +1,350 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// decorationRegex matches the leading decoration of a block comment line such as " * "
+var decorationRegex = regexp.MustCompile(`^\s*\*+\s*`)
+
+// ErrAlreadyReferenced is returned when the only puzzles matching a comment already reference other issues
+var ErrAlreadyReferenced = errors.New("TODO comment already references another issue")
+
+// ReferenceStyle selects how the issue of a puzzle is written back to its comment
+type ReferenceStyle string
+
+const (
+	// ReferenceURL adds an Issue line with the issue URL
+	ReferenceURL ReferenceStyle = "url"
+	// ReferenceNumber adds an Issue line with the issue number such as #123
+	ReferenceNumber ReferenceStyle = "number"
+	// ReferenceInline turns the TODO: marker into TODO(#123):
+	ReferenceInline ReferenceStyle = "inline"
+)
+
+// ParseReferenceStyle validates a reference style name, ReferenceURL when it is empty
+func ParseReferenceStyle(value string) (ReferenceStyle, error) {
+	switch style := ReferenceStyle(strings.ToLower(strings.TrimSpace(value))); style {
+	case "":
+		return ReferenceURL, nil
+	case ReferenceURL, ReferenceNumber, ReferenceInline:
+		return style, nil
+	default:
+		return "", fmt.Errorf("unknown issue reference style: %s", value)
+	}
+}
+
+// ReferenceFormat configures how the issue of a puzzle is written back to its comment
+type ReferenceFormat struct {
+	Style ReferenceStyle
+	// AfterLabels places the Issue line after the Labels line of the puzzle, when it has
+	// one, instead of right after the TODO line
+	AfterLabels bool
+	// Owner and Repo identify the repository of the code, whose issues are referenced as
+	// #123 while issues of other repositories are referenced as owner/repo#123
+	Owner string
+	Repo  string
+	// ServerURL is the GitHub server hosting the issues
+	ServerURL string
+}
+
+// reference returns the short reference of an issue URL, fully qualified for issues of
+// other repositories, or false when the URL is not an issue on the server
+func (f ReferenceFormat) reference(issueURL string) (string, bool) {
+	ref, ok := ParseIssueURL(f.ServerURL, issueURL)
+	if !ok {
+		return "", false
+	}
+	if strings.EqualFold(ref.Owner, f.Owner) && strings.EqualFold(ref.Repo, f.Repo) {
+		return fmt.Sprintf("#%d", ref.Number), true
+	}
+	return ref.String(), true
+}
+
+// refersTo reports whether the puzzle of comment references the issue at issueURL, by its
+// URL or by a reference such as #123
+func (f ReferenceFormat) refersTo(comment TodoComment, issueURL string) bool {
+	if comment.IssueURL != "" {
+		return comment.IssueURL == issueURL
+	}
+
+	issue, ok := ParseIssueURL(f.ServerURL, issueURL)
+	if !ok {
+		return false
+	}
+	ref, ok := ParseIssueReference(comment.IssueRef, f.Owner, f.Repo)
+	return ok && ref.Number == issue.Number && strings.EqualFold(ref.Owner, issue.Owner) && strings.EqualFold(ref.Repo, issue.Repo)
+}
+
+// InsertIssueLine adds an Issue line with the comment's issue URL after its TODO line.
+// The new line reproduces the indentation and comment prefix of the TODO line, and
+// inside block comments it is written as a block interior line with the same decoration.
+// The content keeps its encoding, byte order mark and line endings. It returns false
+// when the puzzle already references an issue and the content is left unchanged.
+func InsertIssueLine(content []byte, comment TodoComment) ([]byte, bool, error) {
+	return InsertIssueReference(content, comment, ReferenceFormat{Style: ReferenceURL})
+}
+
+// InsertIssueReference writes the comment's issue back to its TODO comment in the given
+// format. Markers naming an owner, such as TODO(alice):, keep it and get an Issue line.
+func InsertIssueReference(content []byte, comment TodoComment, format ReferenceFormat) ([]byte, bool, error) {
+	if isNotebook(comment.FilePath) {
+		return insertNotebookReference(content, comment, format)
+	}
+
+	text, err := DecodeText(content)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to decode %s: %w", comment.FilePath, err)
+	}
+
+	lang := DetectLanguage(comment.FilePath, text.Lines)
+	if lang == nil {
+		return nil, false, fmt.Errorf("unsupported file type: %s", comment.FilePath)
+	}
+
+	changed, err := insertReference(text, lang, comment, format)
+	if err != nil || !changed {
+		return content, false, err
+	}
+
+	return text.Encode(), true, nil
+}
+
+// LocateComment finds the puzzle of comment in the current content of its file by its
+// title rather than its line number, which is stale when the file changed since it was
+// scanned. Only puzzles that don't reference an issue yet, or that already reference the
+// issue of comment, are considered, and when several share the title the one closest to
+// the original location is used. It returns the comment with its current location, false
+// when the puzzle is no longer in the file, or ErrAlreadyReferenced when every puzzle with
+// the title references another issue.
+func LocateComment(content []byte, comment TodoComment, terminators Terminators, format ReferenceFormat) (TodoComment, bool, error) {
+	parsed, err := parseContent(comment.FilePath, content, terminators)
+	if err != nil {
+		return comment, false, err
+	}
+
+	// Puzzles in the same notebook cell are closer than any in other cells
+	closer := func(a, b *TodoComment) bool {
+		if da, db := abs(a.Cell-comment.Cell), abs(b.Cell-comment.Cell); da != db {
+			return da < db
+		}
+		return abs(a.LineNumber-comment.LineNumber) < abs(b.LineNumber-comment.LineNumber)
+	}
+
+	var found *TodoComment
+	var referenced []string
+	for i := range parsed {
+		candidate := &parsed[i]
+		if !candidate.sameTitle(comment) {
+			continue
+		}
+		// A puzzle referencing the issue was already written back, by an earlier attempt or run
+		if candidate.IssueURL != "" || candidate.IssueRef != "" {
+			if !format.refersTo(*candidate, comment.IssueURL) {
+				referenced = append(referenced, candidate.Location())
+				continue
+			}
+		}
+		if found == nil || closer(candidate, found) {
+			found = candidate
+		}
+	}
+	if found == nil && len(referenced) > 0 {
+		return comment, false, fmt.Errorf("%w: %s matches puzzles at %s", ErrAlreadyReferenced, comment.Location(), strings.Join(referenced, ", "))
+	}
+	if found == nil {
+		return comment, false, nil
+	}
+
+	comment.Cell = found.Cell
+	comment.LineNumber = found.LineNumber
+	comment.EndLine = found.EndLine
+	comment.Occurrence = found.Occurrence
+	return comment, true, nil
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// insertReference writes the issue of the comment into text in the given format
+func insertReference(text *TextFile, lang *Language, comment TodoComment, format ReferenceFormat) (bool, error) {
+	index := comment.LineNumber - 1
+	if index < 0 || index >= len(text.Lines) {
+		return false, fmt.Errorf("line number %d is out of range for file %s", comment.LineNumber, comment.FilePath)
+	}
+
+	if hasIssue(text.Lines, index, comment.EndLine) {
+		return false, nil
+	}
+
+	ref, isIssue := format.reference(comment.IssueURL)
+	issue := comment.IssueURL
+	if format.Style != ReferenceURL && isIssue {
+		issue = ref
+	}
+
+	line := text.Lines[index]
+	if marker := todoMarkerIndex(line); format.Style == ReferenceInline && isIssue && marker >= 0 && strings.HasPrefix(line[marker:], "TODO:") {
+		return true, text.ReplaceLine(index, line[:marker]+"TODO("+ref+"):"+line[marker+len("TODO:"):])
+	}
+
+	// Owners of TODO(owner): markers are kept and the issue is written on its own line
+	return insertIssueLine(text, lang, comment, issue, format.AfterLabels)
+}
+
+// hasIssue reports whether the puzzle whose TODO line is at index and which ends at
+// endLine already references an issue, in any of the supported forms
+func hasIssue(lines []string, index, endLine int) bool {
+	if hasIssueReference(lines[index]) {
+		return true
+	}
+	for i := index; i < min(max(endLine, index+1), len(lines)); i++ {
+		if issueRegex.MatchString(lines[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasIssueReference reports whether the TODO marker of line references an issue, as in TODO(#123):
+func hasIssueReference(line string) bool {
+	match := todoRegex.FindStringSubmatch(line)
+	return match != nil && issueReferenceRegex.MatchString(strings.TrimSpace(match[1]))
+}
+
+// insertIssueLine adds an Issue line referencing issue after the TODO line of the comment
+// in text or, with afterLabels, after its Labels line
+func insertIssueLine(text *TextFile, lang *Language, comment TodoComment, issue string, afterLabels bool) (bool, error) {
+	todoLineIndex := comment.LineNumber - 1
+
+	// Embedded sections such as <script> in a Vue component use the syntax of their own language
+	lang = languageAt(lang, text.Lines, todoLineIndex)
+
+	prefix, inBlock := commentPrefix(lang, text.Lines, todoLineIndex)
+	issueComment := prefix + "Issue: " + issue
+
+	anchor, directive := todoLineIndex, todoMarkerIndex(text.Lines[todoLineIndex])
+	if afterLabels {
+		for i := todoLineIndex + 1; i < min(comment.EndLine, len(text.Lines)); i++ {
+			if loc := labelsRegex.FindStringIndex(text.Lines[i]); loc != nil {
+				anchor, directive = i, loc[0]
+				break
+			}
+		}
+	}
+
+	// A block comment closing on the line before the Issue line, such as a single-line HTML
+	// comment, is reopened by moving its end delimiter to the Issue line so the directive
+	// stays inside it
+	anchorLine := text.Lines[anchor]
+	if inBlock && directive >= 0 {
+		if end := closingDelimiter(lang, anchorLine[directive:]); end >= 0 {
+			if err := text.ReplaceLine(anchor, strings.TrimRightFunc(anchorLine[:directive+end], unicode.IsSpace)); err != nil {
+				return false, err
+			}
+			issueComment += " " + anchorLine[directive+end:]
+		}
+	}
+
+	if err := text.InsertLine(anchor, issueComment); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// commentPrefix returns the text to put before a directive on a new comment line following
+// the TODO line at index, so that the directive lines up with the TODO, and whether the
+// TODO is inside a block comment
+func commentPrefix(lang *Language, lines []string, index int) (string, bool) {
+	line := lines[index]
+	indent := line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))]
+
+	todoIndex := todoMarkerIndex(line)
+	if todoIndex < 0 {
+		if prefix := lang.lineCommentPrefix(); prefix != "" {
+			return indent + prefix + " ", false
+		}
+		return indent, true
+	}
+
+	prefix := line[:todoIndex]
+	marker := strings.TrimSpace(prefix)
+	blocks := lang.blockComments()
+
+	switch {
+	case marker == "":
+		// Undecorated block comment interior
+		return prefix, true
+	case slices.ContainsFunc(blocks, func(b BlockComment) bool { return strings.Contains(marker, b.Start) }):
+		// Handled below, block delimiters such as "#[" may start with the line comment prefix
+	case matchPrefix(marker, lang.lineCommentPrefixes()) != "":
+		return prefix, false
+	case trailingPrefix(marker, lang.lineCommentPrefixes()) != "":
+		// Comment trailing code, the directive goes on its own comment line below
+		return indent + trailingPrefix(marker, lang.lineCommentPrefixes()) + " ", false
+	case strings.HasPrefix(marker, "*") && !startsWithEnd(marker, blocks):
+		// Decorated block comment interior starting with " * "
+		return prefix, true
+	}
+
+	// The TODO follows the start of a block comment. When the block continues on the next
+	// line, reuse its decoration if it has one, otherwise align the new line with the TODO.
+	if closingDelimiter(lang, line[todoIndex:]) < 0 && index+1 < len(lines) {
+		next := lines[index+1]
+		if decoration := decorationRegex.FindString(next); decoration != "" && !startsWithEnd(strings.TrimSpace(next), blocks) {
+			if !strings.HasSuffix(decoration, " ") && !strings.HasSuffix(decoration, "\t") {
+				decoration += " "
+			}
+			return decoration, true
+		}
+	}
+
+	return blankOut(prefix), true
+}
+
+// trailingPrefix returns the first of prefixes that marker ends with, or an empty string
+func trailingPrefix(marker string, prefixes []string) string {
+	for _, prefix := range prefixes {
+		if strings.HasSuffix(marker, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// closingDelimiter returns the index of the first block comment end delimiter in s, or -1
+func closingDelimiter(lang *Language, s string) int {
+	index := -1
+	for _, block := range lang.blockComments() {
+		if i := strings.Index(s, block.End); i >= 0 && (index < 0 || i < index) {
+			index = i
+		}
+	}
+	return index
+}
+
+// startsWithEnd reports whether s starts with the end delimiter of one of the block comments
+func startsWithEnd(s string, blocks []BlockComment) bool {
+	return slices.ContainsFunc(blocks, func(b BlockComment) bool { return strings.HasPrefix(s, b.End) })
+}
+
+// blankOut replaces every character of s with a space, keeping tabs so the result has the same width
+func blankOut(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return r
+		}
+		return ' '
+	}, s)
+}
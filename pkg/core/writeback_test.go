@@ -0,0 +1,262 @@
+package core
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestInsertIssueLine(t *testing.T) {
+	comment := TodoComment{FilePath: "a.go", LineNumber: 2, IssueURL: "https://github.com/o/r/issues/1"}
+
+	tests := []struct {
+		name string
+		data []byte
+		want []byte
+	}{
+		{
+			name: "crlf",
+			data: []byte("package a\r\n// TODO: Task\r\n"),
+			want: []byte("package a\r\n// TODO: Task\r\n// Issue: https://github.com/o/r/issues/1\r\n"),
+		},
+		{
+			name: "last line without newline",
+			data: []byte("package a\n// TODO: Task"),
+			want: []byte("package a\n// TODO: Task\n// Issue: https://github.com/o/r/issues/1"),
+		},
+		{
+			name: "utf-8 bom",
+			data: []byte("\xEF\xBB\xBFpackage a\n// TODO: Task\n"),
+			want: []byte("\xEF\xBB\xBFpackage a\n// TODO: Task\n// Issue: https://github.com/o/r/issues/1\n"),
+		},
+		{
+			name: "utf-16le",
+			data: encodeUTF16LE("package a\r\n// TODO: Task\r\n"),
+			want: encodeUTF16LE("package a\r\n// TODO: Task\r\n// Issue: https://github.com/o/r/issues/1\r\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed, err := InsertIssueLine(tt.data, comment)
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, changed, err := InsertIssueLine([]byte("package a\n// TODO: Task Issue: #1\n"), comment)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	_, _, err = InsertIssueLine([]byte("package a\n"), comment)
+	assert.Error(t, err)
+}
+
+func TestInsertIssueLineStyle(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		lines string
+		line  int
+		want  string
+	}{
+		{name: "indented line comment", file: "a.go", lines: "func f() {\n\t// TODO: Task\n}\n", line: 2, want: "\t// Issue: URL"},
+		{name: "doc comment", file: "a.rs", lines: "    /// TODO: Task\n", line: 1, want: "    /// Issue: URL"},
+		{name: "decorated block", file: "a.java", lines: "  /*\n   * TODO: Task\n   */\n", line: 2, want: "   * Issue: URL"},
+		{name: "block start with decoration", file: "a.java", lines: "  /** TODO: Task\n   * Description\n   */\n", line: 1, want: "   * Issue: URL"},
+		{name: "block start without decoration", file: "a.html", lines: "\t<!-- TODO: Task\n\t     Description -->\n", line: 1, want: "\t     Issue: URL"},
+		{name: "undecorated block", file: "a.css", lines: "/*\n    TODO: Task\n*/\n", line: 2, want: "    Issue: URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := TodoComment{FilePath: tt.file, LineNumber: tt.line, IssueURL: "URL"}
+			got, changed, err := InsertIssueLine([]byte(tt.lines), comment)
+			require.NoError(t, err)
+			require.True(t, changed)
+
+			lines := strings.Split(string(got), "\n")
+			assert.Equal(t, tt.want, lines[tt.line])
+		})
+	}
+}
+
+func TestInsertIssueReferenceInline(t *testing.T) {
+	url := "https://github.com/o/r/issues/42"
+	inline := ReferenceFormat{Style: ReferenceInline, Owner: "o", Repo: "r"}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+		changed bool
+	}{
+		{name: "plain marker", content: "\t// TODO: Task\n", want: "\t// TODO(#42): Task\n", changed: true},
+		{name: "owner marker keeps owner", content: "// TODO(alice): Task\n", want: "// TODO(alice): Task\n// Issue: #42\n", changed: true},
+		{name: "reference marker", content: "// TODO(#7): Task\n", want: "// TODO(#7): Task\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := TodoComment{FilePath: "a.go", LineNumber: 1, IssueURL: url}
+			got, changed, err := InsertIssueReference([]byte(tt.content), comment, inline)
+			require.NoError(t, err)
+			assert.Equal(t, tt.changed, changed)
+			assert.Equal(t, tt.want, string(got))
+		})
+	}
+
+	// Notebook cells are rewritten in place
+	nb := `{"cells": [{"cell_type": "code", "source": ["# TODO: Task\n", "x = 1"]}]}`
+	got, changed, err := InsertIssueReference([]byte(nb), TodoComment{FilePath: "a.ipynb", Cell: 1, LineNumber: 1, IssueURL: url}, inline)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, `{"cells": [{"cell_type": "code", "source": ["# TODO(#42): Task\n", "x = 1"]}]}`, string(got))
+
+	_, err = ParseReferenceStyle("footnote")
+	assert.Error(t, err)
+}
+
+func TestInsertIssueReferenceFormats(t *testing.T) {
+	content := "// TODO: Task\n// Labels: bug\n// Description\nfunc f() {}\n"
+	comment := TodoComment{FilePath: "a.go", LineNumber: 1, EndLine: 3, IssueURL: "https://github.com/o/r/issues/42"}
+
+	tests := []struct {
+		name   string
+		format ReferenceFormat
+		url    string
+		want   string
+	}{
+		{"url", ReferenceFormat{Style: ReferenceURL}, comment.IssueURL, "// TODO: Task\n// Issue: https://github.com/o/r/issues/42\n// Labels: bug\n"},
+		{"number", ReferenceFormat{Style: ReferenceNumber, Owner: "o", Repo: "r"}, comment.IssueURL, "// TODO: Task\n// Issue: #42\n// Labels: bug\n"},
+		{"number after labels", ReferenceFormat{Style: ReferenceNumber, AfterLabels: true, Owner: "o", Repo: "r"}, comment.IssueURL, "// TODO: Task\n// Labels: bug\n// Issue: #42\n// Description\n"},
+		{"cross-repo number", ReferenceFormat{Style: ReferenceNumber, Owner: "o", Repo: "r"}, "https://github.com/org/tools/issues/7", "// TODO: Task\n// Issue: org/tools#7\n"},
+		{"cross-repo inline", ReferenceFormat{Style: ReferenceInline, Owner: "o", Repo: "r"}, "https://github.com/org/tools/issues/7", "// TODO(org/tools#7): Task\n"},
+		{"unknown server falls back to url", ReferenceFormat{Style: ReferenceNumber, Owner: "o", Repo: "r"}, "https://example.com/o/r/issues/42", "// TODO: Task\n// Issue: https://example.com/o/r/issues/42\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			comment := comment
+			comment.IssueURL = tt.url
+			got, changed, err := InsertIssueReference([]byte(content), comment, tt.format)
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.True(t, strings.HasPrefix(string(got), tt.want), string(got))
+
+			// Every written form marks the puzzle as processed
+			comments, err := parseReader("a.go", GetLanguageForFile("a.go"), strings.NewReader(string(got)))
+			require.NoError(t, err)
+			require.Len(t, comments, 1)
+			assert.Empty(t, FilterUnprocessedComments(comments))
+
+			_, changed, err = InsertIssueReference(got, comments[0], tt.format)
+			require.NoError(t, err)
+			assert.False(t, changed)
+		})
+	}
+}
+
+// TestInsertIssueLineGolden inserts Issue lines for every TODO of an input file per supported
+// language and compares the result with a golden file. Run with -update to rewrite them.
+func TestInsertIssueLineGolden(t *testing.T) {
+	slug := strings.NewReplacer("++", "pp", "#", "sharp", " ", "-")
+
+	for _, lang := range supportedLanguages {
+		ext := lang.Extensions[0]
+		name := slug.Replace(strings.ToLower(lang.Name))
+
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(filepath.Join("testdata", "insert", name+".input"))
+			require.NoError(t, err, "every supported language needs a golden test")
+
+			comments, err := parseReader("file"+ext, &lang, bytes.NewReader(input))
+			require.NoError(t, err)
+			require.NotEmpty(t, comments)
+
+			got := input
+			for i := len(comments) - 1; i >= 0; i-- {
+				comment := comments[i]
+				comment.FilePath = "file" + ext
+				comment.IssueURL = fmt.Sprintf("https://github.com/owner/repo/issues/%d", i+1)
+
+				var changed bool
+				got, changed, err = InsertIssueLine(got, comment)
+				require.NoError(t, err)
+				require.True(t, changed)
+			}
+
+			goldenPath := filepath.Join("testdata", "insert", name+".golden")
+			if *update {
+				require.NoError(t, os.WriteFile(goldenPath, got, 0644))
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			require.NoError(t, err)
+			assert.Equal(t, string(want), string(got))
+
+			// The inserted lines must be parsed back as part of their TODO comments
+			updated, err := parseReader("file"+ext, &lang, bytes.NewReader(got))
+			require.NoError(t, err)
+			require.Len(t, updated, len(comments))
+			for i, comment := range updated {
+				assert.Equal(t, comments[i].Title, comment.Title)
+				assert.Equal(t, fmt.Sprintf("https://github.com/owner/repo/issues/%d", i+1), comment.IssueURL)
+			}
+		})
+	}
+}
+
+func TestLocateComment(t *testing.T) {
+	format := ReferenceFormat{Style: ReferenceURL, Owner: "o", Repo: "r"}
+	content := "package main\n\n// TODO: Add tests\n\nfunc main() {}\n\n// TODO: Add tests\n// TODO: Other puzzle\n"
+	comment := TodoComment{FilePath: "main.go", LineNumber: 6, EndLine: 6, Title: "Add tests", IssueURL: "https://github.com/o/r/issues/1"}
+
+	// The puzzle with the same title closest to the stale line is used
+	located, found, err := LocateComment([]byte(content), comment, 0, format)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 7, located.LineNumber)
+	assert.Equal(t, comment.IssueURL, located.IssueURL)
+
+	comment.LineNumber = 1
+	located, _, err = LocateComment([]byte(content), comment, 0, format)
+	require.NoError(t, err)
+	assert.Equal(t, 3, located.LineNumber)
+
+	// Puzzles referencing another issue are skipped even when they are closer
+	processed := "package main\n\n// TODO: Add tests\n// Issue: https://github.com/o/r/issues/2\n\n// TODO: Add tests\n"
+	comment.LineNumber = 3
+	located, found, err = LocateComment([]byte(processed), comment, 0, format)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 6, located.LineNumber)
+
+	// A puzzle already referencing the issue of the comment is located, so the write-back is a no-op
+	written := "package main\n\n// TODO(#1): Add tests\n"
+	located, found, err = LocateComment([]byte(written), comment, 0, format)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, 3, located.LineNumber)
+
+	// Every puzzle with the title references another issue
+	taken := "package main\n\n// TODO: Add tests\n// Issue: https://github.com/o/r/issues/2\n"
+	_, found, err = LocateComment([]byte(taken), comment, 0, format)
+	assert.ErrorIs(t, err, ErrAlreadyReferenced)
+	assert.False(t, found)
+
+	comment.Title = "Removed puzzle"
+	_, found, err = LocateComment([]byte(content), comment, 0, format)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
@@ -0,0 +1,45 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// csvHeader is the header row of the CSV export
+var csvHeader = []string{"id", "file", "cell", "line", "end_line", "title", "labels", "issue_url", "description", "ignored"}
+
+// WriteCSV writes the puzzles as CSV with a header row, one puzzle per row. The line of
+// puzzles in notebooks is relative to their cell.
+func WriteCSV(w io.Writer, comments []core.TodoComment, opts Options) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		id := comment.Fingerprint()
+		comment = opts.Redactor.Mask(comment)
+		record := []string{
+			id,
+			comment.FilePath,
+			cell(comment),
+			strconv.Itoa(comment.LineNumber),
+			strconv.Itoa(endLine(comment)),
+			comment.Title,
+			strings.Join(comment.Labels, ","),
+			comment.IssueURL,
+			strings.Join(comment.Description, "\n"),
+			strconv.FormatBool(comment.Ignored),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,105 @@
+// Package export writes the inventory of puzzles found in the code in formats
+// consumed by other systems: JSON, CSV, SARIF and the puzzles.xml format of 0pdd.
+package export
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// Format is an inventory export format
+type Format string
+
+const (
+	FormatJSON  Format = "json"
+	FormatCSV   Format = "csv"
+	FormatSARIF Format = "sarif"
+	FormatXML   Format = "xml"
+)
+
+// SchemaVersion is the version of the JSON export schema
+const SchemaVersion = 1
+
+// Options configures an export
+type Options struct {
+	// GeneratedAt is the time the inventory was generated
+	GeneratedAt time.Time
+	// ToolVersion is the version of the action reported in SARIF output
+	ToolVersion string
+	// Redactor masks secrets in the exported text of the puzzles, nil exports it verbatim
+	Redactor *core.Redactor
+}
+
+// ParseFormat validates an export format name
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(name))); format {
+	case FormatJSON, FormatCSV, FormatSARIF, FormatXML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported export format %q, expected one of json, csv, sarif or xml", name)
+	}
+}
+
+// Write writes the puzzles to w in the given format
+func Write(w io.Writer, format Format, comments []core.TodoComment, opts Options) error {
+	switch format {
+	case FormatJSON:
+		return WriteJSON(w, comments, opts)
+	case FormatCSV:
+		return WriteCSV(w, comments, opts)
+	case FormatSARIF:
+		return WriteSARIF(w, comments, opts)
+	case FormatXML:
+		return WriteXML(w, comments, opts)
+	default:
+		return fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+// WriteFile writes the puzzles to the file at path, creating parent directories as needed
+func WriteFile(path string, format Format, comments []core.TodoComment, opts Options) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+
+	if err := Write(file, format, comments, opts); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return file.Close()
+}
+
+// endLine returns the last line of the puzzle, falling back to its first line
+func endLine(comment core.TodoComment) int {
+	return max(comment.EndLine, comment.LineNumber)
+}
+
+// fileLines returns the first and last lines of the puzzle in its file. Lines of notebook
+// cells do not map to lines of the file, so puzzles in notebooks point at its first line.
+func fileLines(comment core.TodoComment) (int, int) {
+	if comment.Cell > 0 {
+		return 1, 1
+	}
+	return comment.LineNumber, endLine(comment)
+}
+
+// cell returns the cell of a puzzle in a notebook, an empty string in other files
+func cell(comment core.TodoComment) string {
+	if comment.Cell > 0 {
+		return strconv.Itoa(comment.Cell)
+	}
+	return ""
+}
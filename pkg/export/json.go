@@ -0,0 +1,70 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// jsonInventory is the versioned JSON export document
+type jsonInventory struct {
+	Version     int          `json:"version"`
+	GeneratedAt time.Time    `json:"generated_at"`
+	Puzzles     []jsonPuzzle `json:"puzzles"`
+}
+
+// jsonPuzzle is a single puzzle in the JSON export
+type jsonPuzzle struct {
+	ID          string   `json:"id"`
+	File        string   `json:"file"`
+	Cell        int      `json:"cell,omitempty"`
+	Line        int      `json:"line"`
+	EndLine     int      `json:"end_line"`
+	Symbol      string   `json:"symbol,omitempty"`
+	Title       string   `json:"title"`
+	Description []string `json:"description"`
+	Labels      []string `json:"labels"`
+	IssueURL    string   `json:"issue_url,omitempty"`
+	Ignored     bool     `json:"ignored,omitempty"`
+}
+
+// WriteJSON writes the puzzles as a versioned JSON document
+func WriteJSON(w io.Writer, comments []core.TodoComment, opts Options) error {
+	inventory := jsonInventory{
+		Version:     SchemaVersion,
+		GeneratedAt: opts.GeneratedAt.UTC(),
+		Puzzles:     make([]jsonPuzzle, 0, len(comments)),
+	}
+
+	for _, comment := range comments {
+		id := comment.Fingerprint()
+		comment = opts.Redactor.Mask(comment)
+		inventory.Puzzles = append(inventory.Puzzles, jsonPuzzle{
+			ID:          id,
+			File:        comment.FilePath,
+			Cell:        comment.Cell,
+			Line:        comment.LineNumber,
+			EndLine:     endLine(comment),
+			Symbol:      comment.QualifiedSymbol(),
+			Title:       comment.Title,
+			Description: nonNil(comment.Description),
+			Labels:      nonNil(comment.Labels),
+			IssueURL:    comment.IssueURL,
+			Ignored:     comment.Ignored,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(inventory)
+}
+
+// nonNil returns an empty slice instead of nil so it's encoded as [] rather than null
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,152 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	sarifRuleID  = "pdd/puzzle"
+
+	// sarifFingerprintKey identifies the puzzle fingerprint in partialFingerprints
+	sarifFingerprintKey = "pddPuzzle/v1"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	Name             string       `json:"name"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID              string             `json:"ruleId"`
+	Level               string             `json:"level"`
+	Message             sarifMessage       `json:"message"`
+	Locations           []sarifLocation    `json:"locations"`
+	PartialFingerprints map[string]string  `json:"partialFingerprints"`
+	Properties          map[string]any     `json:"properties,omitempty"`
+	Suppressions        []sarifSuppression `json:"suppressions,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind string `json:"kind"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+	EndLine   int `json:"endLine"`
+}
+
+// WriteSARIF writes the puzzles as a SARIF 2.1.0 log with one result per puzzle. Puzzles in
+// notebooks are located at the first line of the file with their cell in the properties.
+func WriteSARIF(w io.Writer, comments []core.TodoComment, opts Options) error {
+	results := make([]sarifResult, 0, len(comments))
+	for _, comment := range comments {
+		id := comment.Fingerprint()
+		comment = opts.Redactor.Mask(comment)
+		text := comment.Title
+		if len(comment.Description) > 0 {
+			text += "\n\n" + strings.Join(comment.Description, "\n")
+		}
+
+		properties := map[string]any{}
+		if len(comment.Labels) > 0 {
+			properties["labels"] = comment.Labels
+		}
+		if comment.IssueURL != "" {
+			properties["issueUrl"] = comment.IssueURL
+		}
+		if comment.Cell > 0 {
+			properties["cell"] = comment.Cell
+			properties["cellLine"] = comment.LineNumber
+		}
+		start, end := fileLines(comment)
+
+		var suppressions []sarifSuppression
+		if comment.Ignored {
+			// Suppressed by a pdd:ignore or pdd:disable directive in the source
+			suppressions = []sarifSuppression{{Kind: "inSource"}}
+		}
+
+		results = append(results, sarifResult{
+			RuleID:  sarifRuleID,
+			Level:   "note",
+			Message: sarifMessage{Text: text},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: comment.FilePath},
+					Region:           sarifRegion{StartLine: start, EndLine: end},
+				},
+			}},
+			PartialFingerprints: map[string]string{sarifFingerprintKey: id},
+			Properties:          properties,
+			Suppressions:        suppressions,
+		})
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "pdd-action",
+				Version:        opts.ToolVersion,
+				InformationURI: "https://github.com/ksysoev/pdd-action",
+				Rules: []sarifRule{{
+					ID:               sarifRuleID,
+					Name:             "Puzzle",
+					ShortDescription: sarifMessage{Text: "TODO puzzle to be tracked as an issue"},
+				}},
+			}},
+			Results: results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
@@ -0,0 +1,79 @@
+package export
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// xmlPuzzles is the root element of the 0pdd puzzles.xml format
+type xmlPuzzles struct {
+	XMLName xml.Name    `xml:"puzzles"`
+	Date    string      `xml:"date,attr"`
+	Version string      `xml:"version,attr"`
+	Puzzles []xmlPuzzle `xml:"puzzle"`
+}
+
+// xmlPuzzle is a single puzzle in the 0pdd puzzles.xml format
+type xmlPuzzle struct {
+	Ticket   string `xml:"ticket"`
+	Estimate int    `xml:"estimate"`
+	Role     string `xml:"role"`
+	ID       string `xml:"id"`
+	Lines    string `xml:"lines"`
+	Body     string `xml:"body"`
+	File     string `xml:"file"`
+	Cell     int    `xml:"cell,omitempty"`
+	Author   string `xml:"author"`
+	Email    string `xml:"email"`
+	Time     string `xml:"time"`
+}
+
+// WriteXML writes the puzzles in the puzzles.xml format used by 0pdd. Puzzles in notebooks
+// are located at the first line of the file and their cell.
+func WriteXML(w io.Writer, comments []core.TodoComment, opts Options) error {
+	doc := xmlPuzzles{
+		Date:    opts.GeneratedAt.UTC().Format(time.RFC3339),
+		Version: opts.ToolVersion,
+		Puzzles: make([]xmlPuzzle, 0, len(comments)),
+	}
+
+	for _, comment := range comments {
+		id := comment.Fingerprint()
+		comment = opts.Redactor.Mask(comment)
+		ticket := ""
+		if number := core.IssueNumberFromURL(comment.IssueURL); number > 0 {
+			ticket = strconv.Itoa(number)
+		}
+
+		body := strings.Join(append([]string{comment.Title}, comment.Description...), " ")
+		start, end := fileLines(comment)
+		doc.Puzzles = append(doc.Puzzles, xmlPuzzle{
+			Ticket: ticket,
+			Role:   "DEV",
+			ID:     id,
+			Lines:  fmt.Sprintf("%d-%d", start, end),
+			Body:   body,
+			File:   comment.FilePath,
+			Cell:   comment.Cell,
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,194 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/ksysoev/pdd-action/pkg/logging"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// appJWTLifetime is the lifetime of the JWT used to authenticate as the app, GitHub allows at most 10 minutes
+	appJWTLifetime = 9 * time.Minute
+
+	// appJWTClockSkew backdates the JWT issue time to allow for clock drift between the runner and GitHub
+	appJWTClockSkew = time.Minute
+
+	// installationTokenRefreshMargin is how long before expiry an installation token is refreshed
+	installationTokenRefreshMargin = 5 * time.Minute
+
+	// appTokenTimeout bounds the API calls made to mint an installation token
+	appTokenTimeout = 30 * time.Second
+)
+
+// appTokenSource mints installation access tokens for a GitHub App installed on a repository
+type appTokenSource struct {
+	appID          int64
+	key            *rsa.PrivateKey
+	owner          string
+	repo           string
+	apps           *github.Client
+	mu             sync.Mutex
+	installationID int64
+}
+
+// NewAppTokenSource creates a token source authenticating as a GitHub App installation.
+// The installation is resolved from the repository unless installationID is set.
+// Installation tokens are cached and refreshed automatically before they expire.
+func NewAppTokenSource(appID int64, privateKeyPEM []byte, installationID int64, owner, repo string, config core.Config) (oauth2.TokenSource, error) {
+	key, err := parseAppPrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &appTokenSource{
+		appID:          appID,
+		key:            key,
+		owner:          owner,
+		repo:           repo,
+		installationID: installationID,
+	}
+
+	apps, err := newGitHubClient(&http.Client{Transport: &appJWTTransport{source: src, base: defaultTransport}}, config)
+	if err != nil {
+		return nil, err
+	}
+	src.apps = apps
+
+	return oauth2.ReuseTokenSource(nil, src), nil
+}
+
+// Token mints a new installation access token
+func (s *appTokenSource) Token() (*oauth2.Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), appTokenTimeout)
+	defer cancel()
+
+	installationID, err := s.installation(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, _, err := s.apps.Apps.CreateInstallationToken(ctx, installationID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create installation token for installation %d: %w", installationID, err)
+	}
+
+	// Installation tokens are minted during the run, mask them before anything can log them
+	logging.AddMask(slog.Default(), token.GetToken())
+	slog.Debug("Minted GitHub App installation token", "expires_at", token.GetExpiresAt().Format(time.RFC3339))
+
+	return &oauth2.Token{
+		AccessToken: token.GetToken(),
+		TokenType:   "token",
+		Expiry:      token.GetExpiresAt().Add(-installationTokenRefreshMargin),
+	}, nil
+}
+
+// installation returns the installation ID, looking it up for the repository on first use
+func (s *appTokenSource) installation(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.installationID != 0 {
+		return s.installationID, nil
+	}
+
+	installation, _, err := s.apps.Apps.FindRepositoryInstallation(ctx, s.owner, s.repo)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find installation of app %d on %s/%s: %w", s.appID, s.owner, s.repo, err)
+	}
+
+	s.installationID = installation.GetID()
+	slog.Info("Using GitHub App installation", "app_id", s.appID, "installation_id", s.installationID)
+	return s.installationID, nil
+}
+
+// jwt creates a JSON Web Token signed with the app private key
+func (s *appTokenSource) jwt(now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-appJWTClockSkew).Unix(),
+		"exp": now.Add(appJWTLifetime).Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// appJWTTransport authenticates requests as the GitHub App itself with a fresh JWT
+type appJWTTransport struct {
+	source *appTokenSource
+	base   http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.source.jwt(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// parseAppPrivateKey parses a PEM encoded RSA private key in PKCS#1 or PKCS#8 form
+func parseAppPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode app private key: no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse app private key: %w", err)
+	}
+
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("app private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,96 @@
+package github
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppTokenSource(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+
+	var tokenRequests int
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/installation", func(w http.ResponseWriter, r *http.Request) {
+		verifyAppJWT(t, r, &key.PublicKey)
+		w.Write([]byte(`{"id": 99}`))
+	})
+	mux.HandleFunc("POST /api/v3/app/installations/99/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		verifyAppJWT(t, r, &key.PublicKey)
+		tokenRequests++
+		expiresAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		w.Write([]byte(`{"token": "ghs_installation", "expires_at": "` + expiresAt + `"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	ts, err := NewAppTokenSource(42, keyPEM, 0, "owner", "repo", core.Config{APIURL: server.URL})
+	require.NoError(t, err)
+
+	token, err := ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "ghs_installation", token.AccessToken)
+	assert.True(t, token.Expiry.Before(time.Now().Add(time.Hour)), "token should be refreshed before it expires")
+
+	_, err = ts.Token()
+	require.NoError(t, err)
+	assert.Equal(t, 1, tokenRequests, "valid token should be reused")
+}
+
+func TestParseAppPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	parsed, err := parseAppPrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+	require.NoError(t, err)
+	assert.True(t, key.Equal(parsed))
+
+	_, err = parseAppPrivateKey([]byte("not a key"))
+	assert.Error(t, err)
+}
+
+// verifyAppJWT checks that the request is authenticated with a valid app JWT
+func verifyAppJWT(t *testing.T, r *http.Request, pub *rsa.PublicKey) {
+	t.Helper()
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	require.True(t, ok, "request should use bearer authentication")
+
+	parts := strings.Split(token, ".")
+	require.Len(t, parts, 3)
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	require.NoError(t, err)
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	require.NoError(t, rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature))
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.NoError(t, err)
+
+	var claims struct {
+		Issuer string `json:"iss"`
+		Expiry int64  `json:"exp"`
+	}
+	require.NoError(t, json.Unmarshal(payload, &claims))
+	assert.Equal(t, "42", claims.Issuer)
+	assert.LessOrEqual(t, claims.Expiry, time.Now().Add(10*time.Minute).Unix())
+}
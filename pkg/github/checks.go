@@ -0,0 +1,133 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+const (
+	// CheckRunName is the name of the check run reporting new puzzles
+	CheckRunName = "PDD puzzles"
+
+	// maxAnnotationsPerRequest is the limit of annotations the Checks API accepts in one request
+	maxAnnotationsPerRequest = 50
+)
+
+// CreatePuzzleCheckRun creates a completed check run on the given commit with one
+// annotation per new puzzle. No issues are created; the annotations preview the
+// issues that will be opened once the pull request is merged.
+func (c *Client) CreatePuzzleCheckRun(ctx context.Context, headSHA string, comments []core.TodoComment) error {
+	conclusion := "success"
+	if len(comments) > 0 {
+		conclusion = c.config.CheckConclusion
+		if conclusion == "" {
+			conclusion = "neutral"
+		}
+	}
+
+	title := fmt.Sprintf("%d new puzzle(s)", len(comments))
+	summary := c.checkRunSummary(comments)
+
+	annotations := make([]*github.CheckRunAnnotation, 0, len(comments))
+	for _, comment := range comments {
+		annotations = append(annotations, c.puzzleAnnotation(comment))
+	}
+
+	first := annotations
+	if len(first) > maxAnnotationsPerRequest {
+		first = first[:maxAnnotationsPerRequest]
+	}
+
+	slog.Debug("Creating check run", "name", CheckRunName, "sha", headSHA, "annotations", len(annotations))
+
+	now := github.Timestamp{Time: time.Now()}
+	checkRun, _, err := c.client.Checks.CreateCheckRun(ctx, c.owner, c.repo, github.CreateCheckRunOptions{
+		Name:        CheckRunName,
+		HeadSHA:     headSHA,
+		Status:      github.String("completed"),
+		Conclusion:  github.String(conclusion),
+		CompletedAt: &now,
+		Output: &github.CheckRunOutput{
+			Title:       github.String(title),
+			Summary:     github.String(summary),
+			Annotations: first,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create check run on %s: %w", headSHA, err)
+	}
+
+	// The Checks API accepts at most 50 annotations per request, the rest are
+	// appended by updating the check run in batches.
+	for start := maxAnnotationsPerRequest; start < len(annotations); start += maxAnnotationsPerRequest {
+		end := min(start+maxAnnotationsPerRequest, len(annotations))
+		_, _, err := c.client.Checks.UpdateCheckRun(ctx, c.owner, c.repo, checkRun.GetID(), github.UpdateCheckRunOptions{
+			Name: CheckRunName,
+			Output: &github.CheckRunOutput{
+				Title:       github.String(title),
+				Summary:     github.String(summary),
+				Annotations: annotations[start:end],
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to add annotations to check run %d: %w", checkRun.GetID(), err)
+		}
+	}
+
+	slog.Info("Created check run", "url", checkRun.GetHTMLURL())
+	return nil
+}
+
+// puzzleAnnotation builds a check run annotation previewing the issue for a TODO comment
+func (c *Client) puzzleAnnotation(comment core.TodoComment) *github.CheckRunAnnotation {
+	message := c.issueBody(comment)
+	if labels := nonEmptyLabels(comment.Labels); len(labels) > 0 {
+		message = fmt.Sprintf("Labels: %s\n\n%s", strings.Join(labels, ", "), message)
+	}
+
+	startLine, endLine := comment.LineNumber, max(comment.EndLine, comment.LineNumber)
+	if comment.Cell > 0 {
+		// Lines of notebook cells do not map to lines of the file, so annotate its start
+		startLine, endLine = 1, 1
+	}
+
+	return &github.CheckRunAnnotation{
+		Path:            github.String(comment.FilePath),
+		StartLine:       github.Int(startLine),
+		EndLine:         github.Int(endLine),
+		AnnotationLevel: github.String("notice"),
+		Title:           github.String(c.issueTitle(comment)),
+		Message:         github.String(message),
+	}
+}
+
+// checkRunSummary renders the markdown summary listing the new puzzles
+func (c *Client) checkRunSummary(comments []core.TodoComment) string {
+	if len(comments) == 0 {
+		return "No new puzzles found in this pull request."
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The following %d issue(s) will be created in %s/%s once this pull request is merged:\n\n", len(comments), c.owner, c.repo)
+	for _, comment := range comments {
+		fmt.Fprintf(&sb, "- **%s** (`%s`)\n", c.issueTitle(comment), comment.Location())
+	}
+	return sb.String()
+}
+
+// nonEmptyLabels returns labels with empty entries removed
+func nonEmptyLabels(labels []string) []string {
+	var result []string
+	for _, label := range labels {
+		if label != "" {
+			result = append(result, label)
+		}
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// checksServer records the check runs created and updated on owner/repo
+type checksServer struct {
+	created []github.CreateCheckRunOptions
+	updated []github.UpdateCheckRunOptions
+}
+
+func (s *checksServer) start(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.CreateCheckRunOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		s.created = append(s.created, opts)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 7, "html_url": "https://github.com/owner/repo/runs/7"}`))
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/owner/repo/check-runs/7", func(w http.ResponseWriter, r *http.Request) {
+		var opts github.UpdateCheckRunOptions
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&opts))
+		s.updated = append(s.updated, opts)
+		w.Write([]byte(`{"id": 7}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCreatePuzzleCheckRunBatchesAnnotations(t *testing.T) {
+	withoutWritePacing(t)
+
+	server := &checksServer{}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main", CheckConclusion: "action_required"})
+	require.NoError(t, err)
+
+	comments := make([]core.TodoComment, 120)
+	for i := range comments {
+		comments[i] = core.TodoComment{FilePath: "main.go", LineNumber: i + 1, Title: fmt.Sprintf("Puzzle %d", i+1)}
+	}
+
+	require.NoError(t, client.CreatePuzzleCheckRun(context.Background(), "abc123", comments))
+
+	require.Len(t, server.created, 1)
+	require.Len(t, server.updated, 2)
+	assert.Equal(t, "abc123", server.created[0].HeadSHA)
+	assert.Equal(t, "action_required", server.created[0].GetConclusion())
+	assert.Len(t, server.created[0].Output.Annotations, 50)
+	assert.Len(t, server.updated[0].Output.Annotations, 50)
+	assert.Len(t, server.updated[1].Output.Annotations, 20)
+	assert.Equal(t, 101, server.updated[1].Output.Annotations[0].GetStartLine())
+}
+
+func TestCreatePuzzleCheckRunConclusion(t *testing.T) {
+	withoutWritePacing(t)
+
+	comments := []core.TodoComment{{FilePath: "main.go", LineNumber: 3, Title: "Add tests"}}
+	tests := []struct {
+		name       string
+		configured string
+		comments   []core.TodoComment
+		want       string
+	}{
+		{"no puzzles", "failure", nil, "success"},
+		{"configured", "failure", comments, "failure"},
+		{"default", "", comments, "neutral"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &checksServer{}
+			client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main", CheckConclusion: tt.configured})
+			require.NoError(t, err)
+
+			require.NoError(t, client.CreatePuzzleCheckRun(context.Background(), "abc123", tt.comments))
+			require.Len(t, server.created, 1)
+			assert.Equal(t, tt.want, server.created[0].GetConclusion())
+			assert.Empty(t, server.updated)
+		})
+	}
+}
+
+func TestCreatePuzzleCheckRunNotebook(t *testing.T) {
+	withoutWritePacing(t)
+
+	server := &checksServer{}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	comments := []core.TodoComment{{FilePath: "analysis.ipynb", Cell: 3, LineNumber: 5, EndLine: 7, Title: "Load the dataset"}}
+	require.NoError(t, client.CreatePuzzleCheckRun(context.Background(), "abc123", comments))
+
+	require.Len(t, server.created, 1)
+	annotation := server.created[0].Output.Annotations[0]
+	assert.Equal(t, "analysis.ipynb", annotation.GetPath())
+	assert.Equal(t, 1, annotation.GetStartLine())
+	assert.Equal(t, 1, annotation.GetEndLine())
+	assert.Contains(t, server.created[0].Output.GetSummary(), "analysis.ipynb:cell3:5")
+}
@@ -2,7 +2,10 @@ package github
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net/http"
 	"os"
 	"strings"
 
@@ -20,154 +23,260 @@ type Client struct {
 }
 
 // NewClient creates a new GitHub client
-func NewClient(token, repoFullName string, config core.Config) *Client {
-	ctx := context.Background()
+func NewClient(token, repoFullName string, config core.Config) (*Client, error) {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	return NewClientWithTokenSource(ts, repoFullName, config)
+}
 
-	// Debug token prefix (don't print full token)
-	if len(token) > 4 {
-		fmt.Printf("Token prefix: %s...\n", token[:4])
-	} else {
-		fmt.Printf("Token is too short or empty\n")
+// NewClientWithTokenSource creates a new GitHub client authenticated with tokens from ts
+func NewClientWithTokenSource(ts oauth2.TokenSource, repoFullName string, config core.Config) (*Client, error) {
+	client, err := newGitHubClient(tokenHTTPClient(ts), config)
+	if err != nil {
+		return nil, err
 	}
 
-	parts := strings.Split(repoFullName, "/")
-	var owner, repo string
-	
-	fmt.Printf("Repository full name: %s\n", repoFullName)
-	
-	if len(parts) >= 2 {
-		owner = parts[0]
-		repo = parts[1]
-	} else {
-		// Fallback to environment variables if possible
-		owner = os.Getenv("GITHUB_REPOSITORY_OWNER")
-		if owner == "" {
-			owner = "unknown"
-		}
-		repo = repoFullName // Use as-is if can't split
-	}
-	
-	fmt.Printf("Repository owner: %s, repo: %s\n", owner, repo)
-	fmt.Printf("Target branch for issues: %s\n", config.BranchName)
+	owner, repo := SplitRepository(repoFullName)
+	slog.Debug("GitHub client created", "owner", owner, "repo", repo, "branch", config.BranchName)
 
 	return &Client{
 		client: client,
 		owner:  owner,
 		repo:   repo,
 		config: config,
-	}
+	}, nil
 }
 
 // NewRawClient creates a new raw GitHub client
-func NewRawClient(token string) *github.Client {
-	ctx := context.Background()
+func NewRawClient(token string, config core.Config) (*github.Client, error) {
 	ts := oauth2.StaticTokenSource(
 		&oauth2.Token{AccessToken: token},
 	)
-	tc := oauth2.NewClient(ctx, ts)
-	return github.NewClient(tc)
+	return newGitHubClient(tokenHTTPClient(ts), config)
+}
+
+// tokenHTTPClient creates an HTTP client authenticating requests with tokens from ts
+// on top of the shared retrying transport
+func tokenHTTPClient(ts oauth2.TokenSource) *http.Client {
+	return &http.Client{
+		Transport: &oauth2.Transport{
+			Source: ts,
+			Base:   defaultTransport,
+		},
+	}
+}
+
+// newGitHubClient creates a go-github client on top of the HTTP client. When an API URL
+// other than api.github.com is configured the client targets that GitHub Enterprise Server instance.
+func newGitHubClient(httpClient *http.Client, config core.Config) (*github.Client, error) {
+	client := github.NewClient(httpClient)
+
+	apiURL := strings.TrimRight(config.APIURL, "/")
+	if apiURL == "" || apiURL == core.DefaultAPIURL {
+		return client, nil
+	}
+
+	serverURL := config.ServerURL
+	if serverURL == "" {
+		serverURL = core.ServerURLFromAPIURL(apiURL)
+	}
+
+	slog.Info("Using GitHub Enterprise Server API", "url", apiURL)
+	client, err := client.WithEnterpriseURLs(apiURL, serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure GitHub Enterprise Server URLs: %w", err)
+	}
+	return client, nil
+}
+
+// SplitRepository splits an owner/repo name, falling back to GITHUB_REPOSITORY_OWNER
+// when the name has no owner part
+func SplitRepository(repoFullName string) (owner, repo string) {
+	parts := strings.Split(repoFullName, "/")
+	if len(parts) >= 2 {
+		return parts[0], parts[1]
+	}
+
+	// Fallback to environment variables if possible
+	owner = os.Getenv("GITHUB_REPOSITORY_OWNER")
+	if owner == "" {
+		owner = "unknown"
+	}
+	return owner, repoFullName // Use as-is if can't split
+}
+
+// PullRequestHeadRef returns the name of the head branch of a pull request
+func (c *Client) PullRequestHeadRef(ctx context.Context, prNumber int) (string, error) {
+	pr, _, err := c.client.PullRequests.Get(ctx, c.owner, c.repo, prNumber)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PR #%d: %w", prNumber, err)
+	}
+	return pr.GetHead().GetRef(), nil
+}
+
+// ServerURL returns the web URL of the GitHub server the client targets
+func (c *Client) ServerURL() string {
+	if c.config.ServerURL != "" {
+		return strings.TrimRight(c.config.ServerURL, "/")
+	}
+	return core.ServerURLFromAPIURL(c.config.APIURL)
+}
+
+// IssueRefFromReference resolves an issue reference such as #123 or owner/repo#123 from a TODO marker
+func (c *Client) IssueRefFromReference(ref string) (core.IssueRef, bool) {
+	return core.ParseIssueReference(ref, c.owner, c.repo)
+}
+
+// IssueRefFromURL recognizes an issue URL pointing to the configured GitHub server
+func (c *Client) IssueRefFromURL(issueURL string) (core.IssueRef, bool) {
+	return core.ParseIssueURL(c.ServerURL(), issueURL)
+}
+
+// permalink returns the web URL of the lines of a TODO comment on the target branch
+func (c *Client) permalink(comment core.TodoComment) string {
+	link := fmt.Sprintf("%s/%s/%s/blob/%s/%s", c.ServerURL(), c.owner, c.repo, c.config.BranchName, comment.FilePath)
+	if comment.Cell > 0 {
+		// Notebooks are rendered without line anchors
+		return link
+	}
+	link += fmt.Sprintf("#L%d", comment.LineNumber)
+	if comment.EndLine > comment.LineNumber {
+		link += fmt.Sprintf("-L%d", comment.EndLine)
+	}
+	return link
 }
 
-// CreateIssuesFromComments creates GitHub issues from TODO comments
+// CreateIssuesFromComments creates GitHub issues from TODO comments. It returns the comments
+// whose issue was created and, when some failed, a *MultiError with a PuzzleError for each of them.
+// When ctx is cancelled the comments whose issue was created before are returned with the
+// context error, so they can still be written back.
 func (c *Client) CreateIssuesFromComments(ctx context.Context, comments []core.TodoComment) ([]core.TodoComment, error) {
 	var processedComments []core.TodoComment
 
-	fmt.Printf("Creating issues for %d comments in repository %s/%s\n", len(comments), c.owner, c.repo)
-	fmt.Printf("Using branch for issue creation: %s\n", c.config.BranchName)
+	slog.Debug("Creating issues", "count", len(comments), "owner", c.owner, "repo", c.repo, "branch", c.config.BranchName)
 
 	// Verify credentials by getting rate limit info
 	rateLimit, _, err := c.client.RateLimits(ctx)
 	if err != nil {
-		fmt.Printf("Failed to get rate limits - auth may be invalid: %v\n", err)
+		slog.Warn("Failed to get rate limits, authentication may be invalid", "error", err)
 	} else {
-		fmt.Printf("GitHub API rate limit: %d/%d remaining\n", 
-			rateLimit.GetCore().Remaining, 
-			rateLimit.GetCore().Limit)
+		slog.Debug("GitHub API rate limit", "remaining", rateLimit.GetCore().Remaining, "limit", rateLimit.GetCore().Limit)
 	}
 
 	// Check permissions on the repository
 	permissions, _, perr := c.client.Repositories.GetPermissionLevel(ctx, c.owner, c.repo, "")
 	if perr != nil {
-		fmt.Printf("Failed to get repository permissions: %v\n", perr)
+		slog.Debug("Failed to get repository permissions", "error", perr)
 	} else {
-		fmt.Printf("Current user permissions: %s\n", permissions.GetPermission())
+		slog.Debug("Repository permissions", "permission", permissions.GetPermission())
 	}
 
+	// Skip comments that already have an issue URL
+	var pending []core.TodoComment
 	for _, comment := range comments {
-		// Skip comments that already have an issue URL
-		if comment.IssueURL != "" {
-			continue
+		if comment.IssueURL == "" {
+			pending = append(pending, comment)
 		}
+	}
 
-		// Prepare issue title with optional prefix
-		title := comment.Title
-		if c.config.IssueTitlePrefix != "" {
-			title = fmt.Sprintf("%s %s", c.config.IssueTitlePrefix, title)
+	// Issues are created concurrently, results keep the source order of the comments
+	results, errs, err := runOrdered(ctx, c.concurrency(), pending, c.createIssue)
+
+	var failures MultiError
+	for i, comment := range results {
+		if errs[i] != nil {
+			failures.Add(NewPuzzleError(OpCreateIssue, pending[i], errs[i]))
+			continue
 		}
+		processedComments = append(processedComments, comment)
+	}
 
-		// Prepare issue body
-		body := fmt.Sprintf("Created from TODO comment in `%s` (line %d):\n\n", comment.FilePath, comment.LineNumber)
-		body += strings.Join(comment.Description, "\n")
-		body += fmt.Sprintf("\n\nTarget branch: `%s`", c.config.BranchName)
+	if err != nil {
+		return processedComments, fmt.Errorf("issue creation interrupted after %d of %d issues: %w", len(processedComments), len(pending), err)
+	}
+	return processedComments, failures.Err()
+}
 
-		fmt.Printf("Creating issue with title: %s\n", title)
-		fmt.Printf("Labels: %v\n", comment.Labels)
+// createIssue creates the GitHub issue for a TODO comment and returns the comment with the issue URL
+func (c *Client) createIssue(ctx context.Context, comment core.TodoComment) (core.TodoComment, error) {
+	title := c.issueTitle(comment)
+	body := c.issueBody(comment)
 
-		// Clean up empty labels if any
-		var labels []string
-		for _, label := range comment.Labels {
-			if label != "" {
-				labels = append(labels, label)
-			}
-		}
-		
-		// Print detailed debug information
-		fmt.Printf("About to create issue in %s/%s\n", c.owner, c.repo)
-		fmt.Printf("Issue title: %s\n", title)
-		fmt.Printf("Issue body length: %d characters\n", len(body))
-		fmt.Printf("Issue labels: %v\n", labels)
-		
-		// Create the issue
-		issueRequest := &github.IssueRequest{
-			Title:  &title,
-			Body:   &body,
-		}
-		
-		// Only add labels if we have any
-		if len(labels) > 0 {
-			issueRequest.Labels = &labels
-		}
-		
-		issue, resp, err := c.client.Issues.Create(ctx, c.owner, c.repo, issueRequest)
-		if err != nil {
-			fmt.Printf("Error creating issue: %v\n", err)
-			if resp != nil {
-				fmt.Printf("Response status: %s\n", resp.Status)
-				
-				// Try to get more information about the error
-				if resp.StatusCode == 403 {
-					fmt.Printf("Forbidden error - check token permissions\n")
-				} else if resp.StatusCode == 404 {
-					fmt.Printf("Not Found error - check repository exists and is accessible\n")
-				} else if resp.StatusCode == 422 {
-					fmt.Printf("Validation error - check if required fields are missing\n")
-				}
+	// Clean up empty labels if any
+	labels := nonEmptyLabels(comment.Labels)
+
+	slog.Debug("Creating issue", "title", title, "labels", labels, "body_length", len(body))
+
+	// Create the issue
+	issueRequest := &github.IssueRequest{
+		Title:  &title,
+		Body:   &body,
+	}
+	
+	// Only add labels if we have any
+	if len(labels) > 0 {
+		issueRequest.Labels = &labels
+	}
+
+	// Assign the owner named by a TODO(username) marker
+	if comment.Assignee != "" {
+		issueRequest.Assignees = &[]string{comment.Assignee}
+	}
+	
+	issue, resp, err := c.client.Issues.Create(ctx, c.owner, c.repo, issueRequest)
+	if err != nil && resp != nil && resp.StatusCode == 422 && issueRequest.Assignees != nil {
+		// The owner may not be assignable in this repository, create the issue unassigned
+		slog.Warn("Failed to assign issue, creating it unassigned", "assignee", comment.Assignee, "title", title)
+		issueRequest.Assignees = nil
+		issue, resp, err = c.client.Issues.Create(ctx, c.owner, c.repo, issueRequest)
+	}
+	if err != nil {
+		if resp != nil {
+			// Hint at the likely cause of the error
+			if resp.StatusCode == 403 {
+				slog.Error("Forbidden error - check token permissions", "title", title, "status", resp.Status)
+			} else if resp.StatusCode == 404 {
+				slog.Error("Not Found error - check repository exists and is accessible", "title", title, "status", resp.Status)
+			} else if resp.StatusCode == 422 {
+				slog.Error("Validation error - check if required fields are missing", "title", title, "status", resp.Status)
 			}
-			continue // Skip this comment and try the next one
 		}
+		return comment, fmt.Errorf("failed to create issue %q: %w", title, err)
+	}
 
-		// Update the comment with the issue URL
-		comment.IssueURL = issue.GetHTMLURL()
-		fmt.Printf("Created issue: %s\n", comment.IssueURL)
-		processedComments = append(processedComments, comment)
+	// Update the comment with the issue URL
+	comment.IssueURL = issue.GetHTMLURL()
+	slog.Info("Created issue", "url", comment.IssueURL, "title", title)
+	return comment, nil
+}
+
+// concurrency returns the number of concurrent API calls allowed by the configuration
+func (c *Client) concurrency() int {
+	if c.config.Concurrency > 0 {
+		return c.config.Concurrency
 	}
+	return DefaultConcurrency
+}
+
+// issueTitle builds the issue title for a TODO comment with optional prefix
+func (c *Client) issueTitle(comment core.TodoComment) string {
+	if c.config.IssueTitlePrefix != "" {
+		return fmt.Sprintf("%s %s", c.config.IssueTitlePrefix, comment.Title)
+	}
+	return comment.Title
+}
 
-	return processedComments, nil
+// issueBody builds the issue body for a TODO comment
+func (c *Client) issueBody(comment core.TodoComment) string {
+	body := fmt.Sprintf("Created from TODO comment in [`%s` (%s)](%s)", comment.FilePath, comment.Position(), c.permalink(comment))
+	if symbol := comment.QualifiedSymbol(); symbol != "" {
+		body += fmt.Sprintf(" in `%s`", symbol)
+	}
+	body += ":\n\n"
+	body += strings.Join(comment.Description, "\n")
+	body += fmt.Sprintf("\n\nTarget branch: `%s`", c.config.BranchName)
+	return body
 }
 
 // IsPRMergedToTargetBranch checks if a PR is merged to the target branch
@@ -181,20 +290,56 @@ func (c *Client) IsPRMergedToTargetBranch(ctx context.Context, prNumber int) (bo
 	return pr.GetMerged() && pr.GetBase().GetRef() == c.config.BranchName, nil
 }
 
-// UpdateCommentInFile updates the TODO comment in the file with the issue URL
+// referenceFormat returns how issues are written back to TODO comments in this repository
+func (c *Client) referenceFormat() core.ReferenceFormat {
+	return core.ReferenceFormat{
+		Style:       c.config.IssueReference,
+		AfterLabels: c.config.IssueAfterLabels,
+		Owner:       c.owner,
+		Repo:        c.repo,
+		ServerURL:   c.ServerURL(),
+	}
+}
+
+// DefaultWriteBackAttempts is the default number of attempts to update a file that keeps changing
+const DefaultWriteBackAttempts = 3
+
+// ErrWriteConflict reports a file that kept changing while a TODO comment in it was updated
+var ErrWriteConflict = errors.New("file changed during write-back")
+
+// UpdateCommentInFile updates the TODO comment in the file with the issue URL. The puzzle
+// is located in the current content of the file by its fingerprint, and when the file
+// changes between reading and committing it the update is retried on the new content.
+// It gives up with ErrWriteConflict after the configured number of attempts.
 func (c *Client) UpdateCommentInFile(ctx context.Context, comment core.TodoComment, prNumber int, branch string) error {
-	fmt.Printf("Updating comment in file %s (line %d) for branch %s\n", comment.FilePath, comment.LineNumber, branch)
-	
 	// Make sure branch is non-empty
 	if branch == "" {
-		fmt.Printf("Branch name is empty, using default branch: %s\n", c.config.BranchName)
+		slog.Debug("Branch name is empty, using default branch", "branch", c.config.BranchName)
 		branch = c.config.BranchName
 	}
-	
-	fmt.Printf("Attempting to get file contents from branch: %s\n", branch)
-	
+
+	slog.Debug("Updating comment in file", "path", comment.FilePath, "position", comment.Position(), "branch", branch)
+
+	attempts := c.writeBackAttempts()
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = c.updateComment(ctx, comment, branch)
+		if !isWriteConflict(err) {
+			return err
+		}
+		if attempt < attempts {
+			slog.Warn("File changed during write-back, retrying", "path", comment.FilePath, "branch", branch, "attempt", attempt, "attempts", attempts, "error", err)
+		}
+	}
+
+	return fmt.Errorf("%w: gave up updating %s (branch: %s) after %d attempts because the file kept changing, the last attempt failed with: %w",
+		ErrWriteConflict, comment.FilePath, branch, attempts, err)
+}
+
+// updateComment makes one attempt at writing the issue reference to the TODO comment on branch
+func (c *Client) updateComment(ctx context.Context, comment core.TodoComment, branch string) error {
 	// Get file content from the PR branch
-	fileContent, _, resp, err := c.client.Repositories.GetContents(
+	fileContent, _, _, err := c.client.Repositories.GetContents(
 		ctx,
 		c.owner,
 		c.repo,
@@ -202,10 +347,6 @@ func (c *Client) UpdateCommentInFile(ctx context.Context, comment core.TodoComme
 		&github.RepositoryContentGetOptions{Ref: branch},
 	)
 	if err != nil {
-		fmt.Printf("Error getting file contents: %v\n", err)
-		if resp != nil {
-			fmt.Printf("Response status: %s\n", resp.Status)
-		}
 		return fmt.Errorf("failed to get content of %s (branch: %s): %w", comment.FilePath, branch, err)
 	}
 
@@ -215,56 +356,55 @@ func (c *Client) UpdateCommentInFile(ctx context.Context, comment core.TodoComme
 		return fmt.Errorf("failed to decode content of %s: %w", comment.FilePath, err)
 	}
 
-	// Update the TODO comment with the issue URL
-	lines := strings.Split(content, "\n")
-	if comment.LineNumber-1 < 0 || comment.LineNumber >= len(lines) {
-		return fmt.Errorf("line number %d is out of range for file %s", comment.LineNumber, comment.FilePath)
-	}
-
-	// Find the starting line of the TODO comment
-	todoLineIndex := comment.LineNumber - 1
-	lang := core.GetLanguageForFile(comment.FilePath)
-	if lang == nil {
-		return fmt.Errorf("unsupported file type: %s", comment.FilePath)
-	}
-
-	fmt.Printf("TODO line content: %s\n", lines[todoLineIndex])
-
-	// Insert the Issue line after the TODO line
-	if !strings.Contains(lines[todoLineIndex], "Issue:") {
-		issueComment := fmt.Sprintf("%s Issue: %s", lang.LineComment, comment.IssueURL)
-		fmt.Printf("Adding issue URL line: %s\n", issueComment)
-
-		// Insert the issue line after the TODO line
-		updatedLines := append(lines[:todoLineIndex+1], append([]string{issueComment}, lines[todoLineIndex+1:]...)...)
-		updatedContent := strings.Join(updatedLines, "\n")
-
-		// Create a commit to update the file
-		sha := fileContent.GetSHA()
-		message := fmt.Sprintf("Update TODO comment with issue URL in %s", comment.FilePath)
-		_, resp, err = c.client.Repositories.UpdateFile(
-			ctx,
-			c.owner,
-			c.repo,
-			comment.FilePath,
-			&github.RepositoryContentFileOptions{
-				Message: &message,
-				Content: []byte(updatedContent),
-				SHA:     &sha,
-				Branch:  &branch,
-			},
-		)
-		if err != nil {
-			fmt.Printf("Error updating file: %v\n", err)
-			if resp != nil {
-				fmt.Printf("Response status: %s\n", resp.Status)
-			}
-			return fmt.Errorf("failed to update file %s: %w", comment.FilePath, err)
-		}
-		fmt.Printf("Successfully updated file %s with issue URL\n", comment.FilePath)
-	} else {
-		fmt.Printf("Issue URL already exists in comment, skipping update\n")
+	// The line number is stale when the file changed since it was scanned
+	located, found, err := core.LocateComment([]byte(content), comment, c.config.Terminators, c.referenceFormat())
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("TODO comment at %s is no longer in %s (branch: %s)", comment.Position(), comment.FilePath, branch)
+	}
+	if located.LineNumber != comment.LineNumber || located.Cell != comment.Cell {
+		slog.Debug("TODO comment moved", "path", comment.FilePath, "from", comment.Position(), "to", located.Position())
+	}
+
+	// Write the issue reference to the TODO comment, keeping the file's encoding and line endings
+	updatedContent, changed, err := core.InsertIssueReference([]byte(content), located, c.referenceFormat())
+	if err != nil {
+		return err
+	}
+	if !changed {
+		slog.Debug("Issue already referenced in comment, skipping update", "path", comment.FilePath, "position", located.Position())
+		return nil
 	}
 
+	// Create a commit to update the file, rejected when the file changed since it was read
+	sha := fileContent.GetSHA()
+	message := fmt.Sprintf("Update TODO comment with issue URL in %s", comment.FilePath)
+	_, _, err = c.client.Repositories.UpdateFile(
+		ctx,
+		c.owner,
+		c.repo,
+		comment.FilePath,
+		&github.RepositoryContentFileOptions{
+			Message: &message,
+			Content: updatedContent,
+			SHA:     &sha,
+			Branch:  &branch,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update file %s: %w", comment.FilePath, err)
+	}
+	slog.Debug("Updated file with issue reference", "path", comment.FilePath, "url", comment.IssueURL)
+
 	return nil
-}
\ No newline at end of file
+}
+
+// writeBackAttempts returns the number of attempts to update a file that keeps changing
+func (c *Client) writeBackAttempts() int {
+	if c.config.WriteBackAttempts > 0 {
+		return c.config.WriteBackAttempts
+	}
+	return DefaultWriteBackAttempts
+}
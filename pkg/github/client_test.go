@@ -0,0 +1,152 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contentsServer serves a file of owner/repo through the contents API. Every read returns
+// the next of versions, and updates are rejected with conflictStatus until the last version
+// was read.
+type contentsServer struct {
+	versions       []string
+	conflictStatus int
+	reads          int
+	updates        []string
+}
+
+func (s *contentsServer) start(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/contents/main.go", func(w http.ResponseWriter, r *http.Request) {
+		version := s.versions[min(s.reads, len(s.versions)-1)]
+		s.reads++
+		json.NewEncoder(w).Encode(map[string]string{
+			"type":     "file",
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString([]byte(version)),
+			"sha":      fmt.Sprintf("sha%d", s.reads),
+		})
+	})
+	mux.HandleFunc("PUT /api/v3/repos/owner/repo/contents/main.go", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Content string `json:"content"`
+			SHA     string `json:"sha"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if s.reads < len(s.versions) {
+			w.WriteHeader(s.conflictStatus)
+			w.Write([]byte(`{"message": "main.go does not match ` + body.SHA + `"}`))
+			return
+		}
+
+		content, err := base64.StdEncoding.DecodeString(body.Content)
+		require.NoError(t, err)
+		s.updates = append(s.updates, string(content))
+		w.Write([]byte(`{}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpdateCommentInFileRetriesConflicts(t *testing.T) {
+	withoutWritePacing(t)
+
+	scanned := "package main\n\n// TODO: Add tests\nfunc main() {}\n"
+	// Someone pushes a change moving the puzzle while it's being updated
+	pushed := "package main\n\nimport \"fmt\"\n\n// TODO: Add tests\nfunc main() { fmt.Println() }\n"
+
+	for _, status := range []int{http.StatusConflict, http.StatusUnprocessableEntity} {
+		t.Run(http.StatusText(status), func(t *testing.T) {
+			server := &contentsServer{versions: []string{scanned, pushed}, conflictStatus: status}
+			client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main"})
+			require.NoError(t, err)
+
+			comment := core.TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Add tests", IssueURL: "https://github.com/owner/repo/issues/1"}
+			require.NoError(t, client.UpdateCommentInFile(context.Background(), comment, 1, "main"))
+
+			assert.Equal(t, 2, server.reads)
+			require.Len(t, server.updates, 1)
+			assert.Equal(t, "package main\n\nimport \"fmt\"\n\n// TODO: Add tests\n// Issue: https://github.com/owner/repo/issues/1\nfunc main() { fmt.Println() }\n", server.updates[0])
+		})
+	}
+}
+
+func TestUpdateCommentInFileGivesUp(t *testing.T) {
+	withoutWritePacing(t)
+
+	version := "package main\n\n// TODO: Add tests\n"
+	server := &contentsServer{versions: []string{version, version, version, version}, conflictStatus: http.StatusConflict}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main", WriteBackAttempts: 2})
+	require.NoError(t, err)
+
+	comment := core.TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Add tests", IssueURL: "https://github.com/owner/repo/issues/1"}
+	err = client.UpdateCommentInFile(context.Background(), comment, 1, "main")
+
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrWriteConflict))
+	assert.Contains(t, err.Error(), "gave up updating main.go (branch: main) after 2 attempts")
+	assert.Equal(t, CategoryConflict, Categorize(err))
+	assert.Equal(t, 2, server.reads)
+	assert.Empty(t, server.updates)
+}
+
+func TestUpdateCommentInFileRemovedPuzzle(t *testing.T) {
+	server := &contentsServer{versions: []string{"package main\n"}}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	comment := core.TodoComment{FilePath: "main.go", LineNumber: 3, Title: "Add tests", IssueURL: "https://github.com/owner/repo/issues/1"}
+	err = client.UpdateCommentInFile(context.Background(), comment, 1, "main")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "is no longer in main.go")
+	assert.Empty(t, server.updates)
+}
+
+func TestCreateIssuesFromCommentsCancelled(t *testing.T) {
+	withoutWritePacing(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mux := http.NewServeMux()
+	var created int
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		// The run is cancelled while the second issue is created
+		if created++; created > 1 {
+			cancel()
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 1, "html_url": "https://github.com/owner/repo/issues/1"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.URL, BranchName: "main", Concurrency: 1})
+	require.NoError(t, err)
+
+	comments := []core.TodoComment{
+		{FilePath: "main.go", LineNumber: 3, Title: "First"},
+		{FilePath: "main.go", LineNumber: 9, Title: "Second"},
+		{FilePath: "main.go", LineNumber: 12, Title: "Third"},
+	}
+
+	processed, err := client.CreateIssuesFromComments(ctx, comments)
+	assert.ErrorIs(t, err, context.Canceled)
+	require.Len(t, processed, 1, "the issue created before the cancellation should be returned")
+	assert.Equal(t, "https://github.com/owner/repo/issues/1", processed[0].IssueURL)
+}
@@ -0,0 +1,44 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// OrphanLabel marks issues closed because their reference couldn't be written to the code
+const OrphanLabel = "pdd-orphan"
+
+// CloseOrphanIssue compensates for a failed write-back by closing the issue of the puzzle
+// as not planned, labelled OrphanLabel and with a comment explaining why, so the next run
+// creates a new issue instead of leaving one the code doesn't reference
+func (c *Client) CloseOrphanIssue(ctx context.Context, comment core.TodoComment, cause error) error {
+	ref, ok := c.IssueRefFromURL(comment.IssueURL)
+	if !ok {
+		return fmt.Errorf("issue URL %s does not point to an issue on %s", comment.IssueURL, c.ServerURL())
+	}
+
+	body := fmt.Sprintf("Closing this issue because the TODO comment in `%s` (%s) could not be updated to reference it: %v\n\nThe puzzle gets a new issue on the next run.",
+		comment.FilePath, comment.Position(), cause)
+	if _, _, err := c.client.Issues.CreateComment(ctx, ref.Owner, ref.Repo, ref.Number, &github.IssueComment{Body: &body}); err != nil {
+		return fmt.Errorf("failed to comment on issue %s: %w", ref, err)
+	}
+
+	if _, _, err := c.client.Issues.AddLabelsToIssue(ctx, ref.Owner, ref.Repo, ref.Number, []string{OrphanLabel}); err != nil {
+		return fmt.Errorf("failed to label issue %s: %w", ref, err)
+	}
+
+	_, _, err := c.client.Issues.Edit(ctx, ref.Owner, ref.Repo, ref.Number, &github.IssueRequest{
+		State:       github.String("closed"),
+		StateReason: github.String("not_planned"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to close issue %s: %w", ref, err)
+	}
+
+	slog.Info("Closed orphan issue", "issue", ref.String(), "location", comment.Location())
+	return nil
+}
@@ -0,0 +1,56 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCloseOrphanIssue(t *testing.T) {
+	withoutWritePacing(t)
+
+	var commented bool
+	var labels []string
+	var edit map[string]string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/issues/7/comments", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Contains(t, body["body"], "`main.go` (line 3)")
+		commented = true
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/issues/7/labels", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&labels))
+		w.Write([]byte(`[]`))
+	})
+	mux.HandleFunc("PATCH /api/v3/repos/owner/repo/issues/7", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&edit))
+		w.Write([]byte(`{}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	config := core.Config{APIURL: server.URL + "/api/v3", ServerURL: "https://github.example.com"}
+	client, err := NewClient("token", "owner/repo", config)
+	require.NoError(t, err)
+
+	comment := core.TodoComment{FilePath: "main.go", LineNumber: 3, IssueURL: "https://github.example.com/owner/repo/issues/7"}
+	require.NoError(t, client.CloseOrphanIssue(context.Background(), comment, errors.New("conflict")))
+
+	assert.True(t, commented)
+	assert.Equal(t, []string{OrphanLabel}, labels)
+	assert.Equal(t, map[string]string{"state": "closed", "state_reason": "not_planned"}, edit)
+
+	comment.IssueURL = "https://elsewhere.example.com/owner/repo/issues/7"
+	assert.Error(t, client.CloseOrphanIssue(context.Background(), comment, errors.New("conflict")))
+}
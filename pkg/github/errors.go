@@ -0,0 +1,170 @@
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// ErrorCategory classifies why a GitHub API call failed
+type ErrorCategory string
+
+const (
+	// CategoryAuth is a missing or invalid token, or one lacking permissions
+	CategoryAuth ErrorCategory = "auth"
+	// CategoryNotFound is a repository, file or issue that doesn't exist or isn't visible
+	CategoryNotFound ErrorCategory = "not_found"
+	// CategoryValidation is a request rejected as invalid, such as an unknown label
+	CategoryValidation ErrorCategory = "validation"
+	// CategoryConflict is a file changed since it was read, or a puzzle taken over by another issue
+	CategoryConflict ErrorCategory = "conflict"
+	// CategoryRateLimit is a primary or secondary rate limit that outlasted the retries
+	CategoryRateLimit ErrorCategory = "rate_limit"
+	// CategoryOther is any other failure, such as a network error
+	CategoryOther ErrorCategory = "other"
+)
+
+// Operations failing for a puzzle
+const (
+	OpCreateIssue   = "create issue"
+	OpUpdateComment = "update comment"
+)
+
+// Categorize returns the category of an error returned by the GitHub API client
+func Categorize(err error) ErrorCategory {
+	if errors.Is(err, ErrWriteConflict) || errors.Is(err, core.ErrAlreadyReferenced) {
+		return CategoryConflict
+	}
+
+	var rateLimitErr *github.RateLimitError
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseErr) {
+		return CategoryRateLimit
+	}
+
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return CategoryOther
+	}
+
+	switch errResp.Response.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return CategoryAuth
+	case http.StatusNotFound:
+		return CategoryNotFound
+	case http.StatusConflict:
+		return CategoryConflict
+	case http.StatusUnprocessableEntity:
+		return CategoryValidation
+	case http.StatusTooManyRequests:
+		return CategoryRateLimit
+	}
+	return CategoryOther
+}
+
+// PuzzleError is the failure of an operation on the issue or the comment of a puzzle
+type PuzzleError struct {
+	Op       string
+	Comment  core.TodoComment
+	Category ErrorCategory
+	Err      error
+}
+
+// NewPuzzleError creates the error of op failing for the puzzle of comment with err
+func NewPuzzleError(op string, comment core.TodoComment, err error) *PuzzleError {
+	return &PuzzleError{Op: op, Comment: comment, Category: Categorize(err), Err: err}
+}
+
+// Error returns the operation, the location of the puzzle and the cause
+func (e *PuzzleError) Error() string {
+	return fmt.Sprintf("failed to %s for %s (%s): %v", e.Op, e.Comment.Location(), e.Category, e.Err)
+}
+
+// Unwrap returns the cause of the failure
+func (e *PuzzleError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError aggregates the failures of the puzzles processed in a run
+type MultiError struct {
+	Errors []*PuzzleError
+}
+
+// Add appends errs to the failures
+func (e *MultiError) Add(errs ...*PuzzleError) {
+	e.Errors = append(e.Errors, errs...)
+}
+
+// Err returns the aggregated error, nil when nothing failed
+func (e *MultiError) Err() error {
+	if e == nil || len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Categories returns the number of failures in each category
+func (e *MultiError) Categories() map[ErrorCategory]int {
+	categories := make(map[ErrorCategory]int)
+	for _, err := range e.Errors {
+		categories[err.Category]++
+	}
+	return categories
+}
+
+// Failed returns the number of distinct puzzles with at least one failure
+func (e *MultiError) Failed() int {
+	locations := make(map[string]bool)
+	for _, err := range e.Errors {
+		locations[err.Comment.Location()] = true
+	}
+	return len(locations)
+}
+
+// Summary returns the failure counts per category in a stable order, such as auth=1,conflict=2
+func (e *MultiError) Summary() string {
+	categories := e.Categories()
+	names := make([]string, 0, len(categories))
+	for category := range categories {
+		names = append(names, string(category))
+	}
+	slices.Sort(names)
+
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, categories[ErrorCategory(name)])
+	}
+	return strings.Join(parts, ",")
+}
+
+// Error summarizes the failures by category
+func (e *MultiError) Error() string {
+	if len(e.Errors) == 1 {
+		return e.Errors[0].Error()
+	}
+	return fmt.Sprintf("%d operations failed for %d puzzles (%s)", len(e.Errors), e.Failed(), e.Summary())
+}
+
+// Unwrap returns the individual failures
+func (e *MultiError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// isWriteConflict reports whether a file update was rejected because the file changed
+// since it was read, which the contents API reports as 409 or 422
+func isWriteConflict(err error) bool {
+	var errResp *github.ErrorResponse
+	if !errors.As(err, &errResp) || errResp.Response == nil {
+		return false
+	}
+	return errResp.Response.StatusCode == http.StatusConflict || errResp.Response.StatusCode == http.StatusUnprocessableEntity
+}
@@ -0,0 +1,97 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCategorize(t *testing.T) {
+	responseErr := func(status int) error {
+		return fmt.Errorf("failed to update file: %w", &github.ErrorResponse{Response: &http.Response{StatusCode: status}})
+	}
+
+	assert.Equal(t, CategoryAuth, Categorize(responseErr(http.StatusUnauthorized)))
+	assert.Equal(t, CategoryAuth, Categorize(responseErr(http.StatusForbidden)))
+	assert.Equal(t, CategoryNotFound, Categorize(responseErr(http.StatusNotFound)))
+	assert.Equal(t, CategoryConflict, Categorize(responseErr(http.StatusConflict)))
+	assert.Equal(t, CategoryValidation, Categorize(responseErr(http.StatusUnprocessableEntity)))
+	assert.Equal(t, CategoryConflict, Categorize(fmt.Errorf("failed to locate puzzle: %w", core.ErrAlreadyReferenced)))
+	assert.Equal(t, CategoryRateLimit, Categorize(&github.RateLimitError{}))
+	assert.Equal(t, CategoryRateLimit, Categorize(&github.AbuseRateLimitError{}))
+	assert.Equal(t, CategoryOther, Categorize(errors.New("connection reset")))
+}
+
+func TestMultiError(t *testing.T) {
+	var failures MultiError
+	assert.NoError(t, failures.Err())
+	assert.Equal(t, "", failures.Summary())
+
+	first := core.TodoComment{FilePath: "main.go", LineNumber: 3}
+	second := core.TodoComment{FilePath: "util.go", LineNumber: 7}
+	cause := &github.ErrorResponse{Response: &http.Response{StatusCode: http.StatusConflict}}
+
+	failures.Add(
+		NewPuzzleError(OpCreateIssue, first, errors.New("timeout")),
+		NewPuzzleError(OpUpdateComment, second, cause),
+		NewPuzzleError(OpUpdateComment, first, cause),
+	)
+
+	err := failures.Err()
+	require.Error(t, err)
+	assert.Equal(t, 2, failures.Failed())
+	assert.Equal(t, "conflict=2,other=1", failures.Summary())
+	assert.Equal(t, "3 operations failed for 2 puzzles (conflict=2,other=1)", err.Error())
+	assert.ErrorIs(t, err, cause)
+
+	var puzzleErr *PuzzleError
+	require.ErrorAs(t, err, &puzzleErr)
+	assert.Equal(t, "failed to create issue for main.go:3 (other): timeout", puzzleErr.Error())
+}
+
+func TestCreateIssuesFromCommentsPartialFailure(t *testing.T) {
+	withoutWritePacing(t)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/issues", func(w http.ResponseWriter, r *http.Request) {
+		var req github.IssueRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.GetTitle() == "Broken" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "Validation Failed"}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"number": 1, "html_url": "https://github.com/owner/repo/issues/1"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	comments := []core.TodoComment{
+		{FilePath: "main.go", LineNumber: 3, Title: "Works"},
+		{FilePath: "main.go", LineNumber: 9, Title: "Broken"},
+	}
+
+	processed, err := client.CreateIssuesFromComments(context.Background(), comments)
+	require.Len(t, processed, 1)
+	assert.Equal(t, "https://github.com/owner/repo/issues/1", processed[0].IssueURL)
+
+	var failures *MultiError
+	require.ErrorAs(t, err, &failures)
+	require.Len(t, failures.Errors, 1)
+	assert.Equal(t, OpCreateIssue, failures.Errors[0].Op)
+	assert.Equal(t, CategoryValidation, failures.Errors[0].Category)
+	assert.Equal(t, 9, failures.Errors[0].Comment.LineNumber)
+}
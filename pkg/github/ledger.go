@@ -0,0 +1,202 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/google/go-github/v60/github"
+	"github.com/ksysoev/pdd-action/pkg/core"
+)
+
+// LoadLedger reads the ledger stored at path on the given branch. A missing branch or
+// file yields an empty ledger. The returned SHA identifies the file version and must be
+// passed to SaveLedger to detect concurrent modifications.
+func (c *Client) LoadLedger(ctx context.Context, path, branch string) (*core.Ledger, string, error) {
+	fileContent, _, _, err := c.client.Repositories.GetContents(
+		ctx,
+		c.owner,
+		c.repo,
+		path,
+		&github.RepositoryContentGetOptions{Ref: branch},
+	)
+	if isNotFound(err) {
+		slog.Info("Ledger not found, starting with an empty ledger", "path", path, "branch", branch)
+		return core.NewLedger(), "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get ledger %s (branch: %s): %w", path, branch, err)
+	}
+
+	content, err := fileContent.GetContent()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode ledger %s: %w", path, err)
+	}
+
+	ledger, err := core.UnmarshalLedger([]byte(content))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ledger, fileContent.GetSHA(), nil
+}
+
+// SaveLedger commits the ledger to path on the given branch in a single commit. The
+// commit is rejected if the file changed since it was loaded with sha, then the latest
+// ledger is loaded, merged into ledger and the save retried. It gives up with
+// ErrWriteConflict after the configured number of attempts. When the branch does not
+// exist yet it is created as an orphan branch containing only the ledger.
+func (c *Client) SaveLedger(ctx context.Context, path, branch string, ledger *core.Ledger, sha string) error {
+	attempts := c.writeBackAttempts()
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = c.saveLedger(ctx, path, branch, ledger, sha)
+		if !isWriteConflict(err) {
+			return err
+		}
+		if attempt == attempts {
+			break
+		}
+
+		slog.Warn("Ledger changed since it was loaded, merging and retrying", "path", path, "branch", branch, "attempt", attempt, "attempts", attempts, "error", err)
+		latest, latestSHA, lerr := c.LoadLedger(ctx, path, branch)
+		if lerr != nil {
+			return lerr
+		}
+		ledger.Merge(latest)
+		sha = latestSHA
+	}
+
+	return fmt.Errorf("%w: gave up saving ledger %s (branch: %s) after %d attempts because it kept changing, the last attempt failed with: %w",
+		ErrWriteConflict, path, branch, attempts, err)
+}
+
+// saveLedger makes one attempt at committing the ledger to path on branch
+func (c *Client) saveLedger(ctx context.Context, path, branch string, ledger *core.Ledger, sha string) error {
+	data, err := core.MarshalLedger(ledger)
+	if err != nil {
+		return fmt.Errorf("failed to serialize ledger: %w", err)
+	}
+
+	// GetBranch reports a missing branch with a plain error, only its response has the status
+	_, resp, err := c.client.Repositories.GetBranch(ctx, c.owner, c.repo, branch, 0)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return c.createOrphanBranch(ctx, branch, path, data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get branch %s: %w", branch, err)
+	}
+
+	message := fmt.Sprintf("Update PDD ledger %s", path)
+	opts := &github.RepositoryContentFileOptions{
+		Message: &message,
+		Content: data,
+		Branch:  &branch,
+	}
+	if sha != "" {
+		opts.SHA = &sha
+	}
+
+	if _, _, err := c.client.Repositories.UpdateFile(ctx, c.owner, c.repo, path, opts); err != nil {
+		return fmt.Errorf("failed to update ledger %s (branch: %s): %w", path, branch, err)
+	}
+
+	slog.Debug("Saved ledger", "path", path, "branch", branch)
+	return nil
+}
+
+// RefreshLedgerStates looks up the issues of the open ledger entries concurrently and
+// marks the entries whose issue was closed
+func (c *Client) RefreshLedgerStates(ctx context.Context, ledger *core.Ledger) error {
+	var refs []core.IssueRef
+	var entries []*core.LedgerEntry
+	for i := range ledger.Entries {
+		entry := &ledger.Entries[i]
+		if entry.Status != core.LedgerStatusOpen {
+			continue
+		}
+
+		ref, ok := c.IssueRefFromURL(entry.IssueURL)
+		if !ok {
+			if entry.IssueNumber == 0 {
+				continue
+			}
+			ref = core.IssueRef{Owner: c.owner, Repo: c.repo, Number: entry.IssueNumber}
+		}
+
+		refs = append(refs, ref)
+		entries = append(entries, entry)
+	}
+
+	states, errs, err := runOrdered(ctx, c.concurrency(), refs, c.issueState)
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range entries {
+		if errs[i] != nil {
+			slog.Warn("Failed to get state of issue", "issue", refs[i].String(), "error", errs[i])
+			continue
+		}
+		if states[i] == "closed" {
+			entry.Status = core.LedgerStatusClosed
+		}
+	}
+
+	return nil
+}
+
+// issueState returns the state of an issue, open or closed
+func (c *Client) issueState(ctx context.Context, ref core.IssueRef) (string, error) {
+	issue, _, err := c.client.Issues.Get(ctx, ref.Owner, ref.Repo, ref.Number)
+	if err != nil {
+		return "", err
+	}
+	return issue.GetState(), nil
+}
+
+// createOrphanBranch creates a branch without history whose only file is the ledger
+func (c *Client) createOrphanBranch(ctx context.Context, branch, path string, data []byte) error {
+	slog.Info("Creating orphan branch for ledger", "branch", branch, "path", path)
+
+	content := string(data)
+	tree, _, err := c.client.Git.CreateTree(ctx, c.owner, c.repo, "", []*github.TreeEntry{
+		{
+			Path:    &path,
+			Mode:    github.String("100644"),
+			Type:    github.String("blob"),
+			Content: &content,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create ledger tree: %w", err)
+	}
+
+	commit, _, err := c.client.Git.CreateCommit(ctx, c.owner, c.repo, &github.Commit{
+		Message: github.String(fmt.Sprintf("Create PDD ledger %s", path)),
+		Tree:    tree,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create ledger commit: %w", err)
+	}
+
+	_, _, err = c.client.Git.CreateRef(ctx, c.owner, c.repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: commit.SHA},
+	})
+	if err != nil {
+		// A concurrent run created the branch first, the 422 response is a write conflict
+		// so the ledger is reloaded from the branch and the save retried as an update
+		return fmt.Errorf("failed to create branch %s: %w", branch, err)
+	}
+
+	return nil
+}
+
+// isNotFound reports whether err is a GitHub API 404 response
+func isNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,240 @@
+package github
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ksysoev/pdd-action/pkg/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const ledgerPath = ".pdd/ledger.json"
+
+// ledgerServer serves the ledger of owner/repo on the pdd-ledger branch. Updates with a
+// stale SHA, or every update when stale is set, are rejected with 409, and a concurrent
+// run saves concurrent, when set, on the first update or branch creation.
+type ledgerServer struct {
+	branch     bool
+	ledger     *core.Ledger
+	version    int
+	concurrent *core.Ledger
+	stale      bool
+	updates    int
+	refs       []string
+	trees      []string
+}
+
+func (s *ledgerServer) sha() string {
+	return fmt.Sprintf("sha%d", s.version)
+}
+
+// saveConcurrent saves the ledger of the concurrent run, reporting whether there was one
+func (s *ledgerServer) saveConcurrent() bool {
+	if s.concurrent == nil {
+		return false
+	}
+	s.branch, s.ledger, s.concurrent = true, s.concurrent, nil
+	s.version++
+	return true
+}
+
+func (s *ledgerServer) start(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/branches/pdd-ledger", func(w http.ResponseWriter, r *http.Request) {
+		if !s.branch {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Branch not found"}`))
+			return
+		}
+		w.Write([]byte(`{"name": "pdd-ledger"}`))
+	})
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/contents/"+ledgerPath, func(w http.ResponseWriter, r *http.Request) {
+		if !s.branch || s.ledger == nil {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message": "Not Found"}`))
+			return
+		}
+		data, err := core.MarshalLedger(s.ledger)
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{
+			"type":     "file",
+			"encoding": "base64",
+			"content":  base64.StdEncoding.EncodeToString(data),
+			"sha":      s.sha(),
+		})
+	})
+	mux.HandleFunc("PUT /api/v3/repos/owner/repo/contents/"+ledgerPath, func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Content string `json:"content"`
+			SHA     string `json:"sha"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		s.updates++
+		if s.saveConcurrent() || s.stale || body.SHA != s.sha() {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"message": "` + ledgerPath + ` does not match ` + body.SHA + `"}`))
+			return
+		}
+
+		content, err := base64.StdEncoding.DecodeString(body.Content)
+		require.NoError(t, err)
+		s.ledger, err = core.UnmarshalLedger(content)
+		require.NoError(t, err)
+		s.version++
+		w.Write([]byte(`{}`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/git/trees", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Tree []struct {
+				Path    string `json:"path"`
+				Content string `json:"content"`
+			} `json:"tree"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		require.Len(t, body.Tree, 1)
+		assert.Equal(t, ledgerPath, body.Tree[0].Path)
+		s.trees = append(s.trees, body.Tree[0].Content)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sha": "tree1"}`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/git/commits", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sha": "commit1"}`))
+	})
+	mux.HandleFunc("POST /api/v3/repos/owner/repo/git/refs", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		if s.branch || s.saveConcurrent() {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"message": "Reference already exists"}`))
+			return
+		}
+		s.branch = true
+		s.refs = append(s.refs, body.Ref)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"ref": "` + body.Ref + `"}`))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+// testLedger returns a ledger with one entry per title
+func testLedger(titles ...string) *core.Ledger {
+	ledger := core.NewLedger()
+	for i, title := range titles {
+		ledger.Record(core.TodoComment{FilePath: "main.go", Title: title, IssueURL: fmt.Sprintf("https://github.com/owner/repo/issues/%d", i+1)}, time.Now())
+	}
+	return ledger
+}
+
+func TestSaveLedgerCreatesBranch(t *testing.T) {
+	withoutWritePacing(t)
+
+	server := &ledgerServer{}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	ledger, sha, err := client.LoadLedger(context.Background(), ledgerPath, "pdd-ledger")
+	require.NoError(t, err)
+	assert.Empty(t, ledger.Entries)
+	assert.Empty(t, sha)
+
+	ledger.Record(core.TodoComment{FilePath: "main.go", Title: "Add tests", IssueURL: "https://github.com/owner/repo/issues/1"}, time.Now())
+	require.NoError(t, client.SaveLedger(context.Background(), ledgerPath, "pdd-ledger", ledger, sha))
+
+	assert.Equal(t, []string{"refs/heads/pdd-ledger"}, server.refs)
+	require.Len(t, server.trees, 1)
+	assert.Contains(t, server.trees[0], "Add tests")
+	assert.Zero(t, server.updates)
+}
+
+func TestSaveLedgerBranchCreatedConcurrently(t *testing.T) {
+	withoutWritePacing(t)
+
+	server := &ledgerServer{concurrent: testLedger("Concurrent puzzle")}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	ledger := testLedger("Add tests")
+	require.NoError(t, client.SaveLedger(context.Background(), ledgerPath, "pdd-ledger", ledger, ""))
+
+	// The branch created by the other run is updated with both entries
+	assert.Empty(t, server.refs)
+	assert.Equal(t, 1, server.updates)
+	require.Len(t, server.ledger.Entries, 2)
+	assert.Equal(t, "Add tests", server.ledger.Entries[0].Title)
+	assert.Equal(t, "Concurrent puzzle", server.ledger.Entries[1].Title)
+}
+
+func TestSaveLedgerStaleSHA(t *testing.T) {
+	withoutWritePacing(t)
+
+	server := &ledgerServer{branch: true, ledger: testLedger("Add tests"), concurrent: testLedger("Add tests", "Concurrent puzzle")}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	ledger, sha, err := client.LoadLedger(context.Background(), ledgerPath, "pdd-ledger")
+	require.NoError(t, err)
+	ledger.Retries = core.RetryQueue{{Fingerprint: "retry", IssueURL: "https://github.com/owner/repo/issues/1"}}
+
+	require.NoError(t, client.SaveLedger(context.Background(), ledgerPath, "pdd-ledger", ledger, sha))
+
+	assert.Equal(t, 2, server.updates)
+	require.Len(t, server.ledger.Entries, 2, "the entries of the concurrent run should be merged")
+	assert.Equal(t, "Concurrent puzzle", server.ledger.Entries[1].Title)
+	assert.Len(t, server.ledger.Retries, 1, "the queued write-backs should be kept")
+}
+
+func TestSaveLedgerGivesUp(t *testing.T) {
+	withoutWritePacing(t)
+
+	server := &ledgerServer{branch: true, ledger: testLedger("Add tests"), stale: true}
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.start(t).URL, BranchName: "main", WriteBackAttempts: 2})
+	require.NoError(t, err)
+
+	err = client.SaveLedger(context.Background(), ledgerPath, "pdd-ledger", testLedger("Add tests"), "sha0")
+	assert.True(t, errors.Is(err, ErrWriteConflict))
+	assert.Equal(t, 2, server.updates)
+}
+
+func TestRefreshLedgerStates(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/issues/1", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 1, "state": "closed"}`))
+	})
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/issues/2", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"number": 2, "state": "open"}`))
+	})
+	mux.HandleFunc("GET /api/v3/repos/owner/repo/issues/3", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message": "Not Found"}`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	client, err := NewClient("token", "owner/repo", core.Config{APIURL: server.URL, BranchName: "main"})
+	require.NoError(t, err)
+
+	ledger := testLedger("Closed puzzle", "Open puzzle", "Missing issue", "Removed puzzle")
+	ledger.Entries[3].Status = core.LedgerStatusRemoved
+
+	require.NoError(t, client.RefreshLedgerStates(context.Background(), ledger))
+
+	assert.Equal(t, core.LedgerStatusClosed, ledger.Entries[0].Status)
+	assert.Equal(t, core.LedgerStatusOpen, ledger.Entries[1].Status)
+	assert.Equal(t, core.LedgerStatusOpen, ledger.Entries[2].Status, "an issue that can't be looked up should stay open")
+	assert.Equal(t, core.LedgerStatusRemoved, ledger.Entries[3].Status, "only open entries should be refreshed")
+}
@@ -0,0 +1,47 @@
+package github
+
+import (
+	"context"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultConcurrency is the default number of concurrent GitHub API calls
+const DefaultConcurrency = 4
+
+// runOrdered calls fn for every item with at most limit calls in flight. Results and
+// per-item errors are returned in the order of items regardless of completion order,
+// a failing item doesn't stop the others. Items are no longer started once ctx is
+// cancelled, in which case the results of the items that completed are returned with
+// the context error and the items that never started get it as their error.
+func runOrdered[T, R any](ctx context.Context, limit int, items []T, fn func(context.Context, T) (R, error)) ([]R, []error, error) {
+	results := make([]R, len(items))
+	errs := make([]error, len(items))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(limit, 1))
+
+	started := 0
+	for i, item := range items {
+		if gctx.Err() != nil {
+			break
+		}
+
+		started++
+		g.Go(func() error {
+			results[i], errs[i] = fn(gctx, item)
+			return nil
+		})
+	}
+
+	// The calls never fail the group, so only the cancellation of ctx is reported
+	g.Wait()
+	if err := ctx.Err(); err != nil {
+		for i := started; i < len(items); i++ {
+			errs[i] = err
+		}
+		return results, errs, err
+	}
+
+	return results, errs, nil
+}
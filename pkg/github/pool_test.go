@@ -0,0 +1,60 @@
+package github
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunOrdered(t *testing.T) {
+	items := []int{5, 1, 4, 2, 3, 0}
+
+	var inFlight, maxInFlight atomic.Int32
+	results, errs, err := runOrdered(context.Background(), 2, items, func(_ context.Context, item int) (int, error) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := maxInFlight.Load()
+			if current <= seen || maxInFlight.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+
+		// Later items finish first to make sure results keep the source order
+		time.Sleep(time.Duration(item) * time.Millisecond)
+		if item == 4 {
+			return 0, errors.New("failed")
+		}
+		return item * 10, nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []int{50, 10, 0, 20, 30, 0}, results)
+	assert.Nil(t, errs[0])
+	assert.EqualError(t, errs[2], "failed")
+	assert.LessOrEqual(t, maxInFlight.Load(), int32(2))
+}
+
+func TestRunOrderedCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls atomic.Int32
+	results, errs, err := runOrdered(ctx, 1, []int{1, 2, 3, 4}, func(_ context.Context, item int) (int, error) {
+		calls.Add(1)
+		cancel()
+		return item, nil
+	})
+
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, calls.Load(), int32(4), "no new items should start after cancellation")
+
+	// The items that completed keep their results, the others fail with the context error
+	assert.Equal(t, 1, results[0])
+	assert.NoError(t, errs[0])
+	assert.ErrorIs(t, errs[3], context.Canceled)
+}
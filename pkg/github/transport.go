@@ -0,0 +1,311 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries       = 5
+	defaultBaseDelay        = time.Second
+	defaultMaxDelay         = time.Minute
+	defaultMaxRateLimitWait = 15 * time.Minute
+
+	// defaultWriteInterval paces content-creating requests, GitHub recommends waiting
+	// at least one second between them to avoid secondary rate limits
+	defaultWriteInterval = time.Second
+
+	// secondaryRateLimitWait is how long to wait after a secondary rate limit without
+	// a Retry-After header, GitHub recommends at least one minute
+	secondaryRateLimitWait = time.Minute
+
+	// maxErrorBodySize limits how much of an error response is read to detect rate limits
+	maxErrorBodySize = 64 << 10
+)
+
+// RetryTransport is an http.RoundTripper that handles GitHub API rate limits and transient
+// failures. Rate limited requests are retried after the delay from the Retry-After or
+// X-RateLimit-Reset headers, idempotent requests failing with 5xx or network errors are
+// retried with jittered exponential backoff, and content-creating requests are paced.
+type RetryTransport struct {
+	// Base is the underlying transport, http.DefaultTransport when nil
+	Base http.RoundTripper
+	// MaxRetries is the maximum number of retries of a request
+	MaxRetries int
+	// BaseDelay is the initial backoff delay, doubled on every retry
+	BaseDelay time.Duration
+	// MaxDelay caps the backoff delay
+	MaxDelay time.Duration
+	// MaxRateLimitWait is the longest the transport waits for a rate limit to reset before giving up
+	MaxRateLimitWait time.Duration
+	// WriteInterval is the minimum time between content-creating requests
+	WriteInterval time.Duration
+	// Logger receives a structured record for every retry
+	Logger *slog.Logger
+
+	mu        sync.Mutex
+	nextWrite time.Time
+
+	// now and sleep are replaced in tests
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryTransport creates a RetryTransport on top of base with the default retry policy
+func NewRetryTransport(base http.RoundTripper) *RetryTransport {
+	return &RetryTransport{
+		Base:             base,
+		MaxRetries:       defaultMaxRetries,
+		BaseDelay:        defaultBaseDelay,
+		MaxDelay:         defaultMaxDelay,
+		MaxRateLimitWait: defaultMaxRateLimitWait,
+		WriteInterval:    defaultWriteInterval,
+	}
+}
+
+// defaultTransport is shared by all clients so content-creating requests are paced across them
+var defaultTransport = NewRetryTransport(nil)
+
+// RoundTrip implements http.RoundTripper
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	if isWriteMethod(req.Method) {
+		if err := t.pace(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			if attemptReq, err = rewindRequest(req); err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.base().RoundTrip(attemptReq)
+
+		if attempt >= t.MaxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		delay, reason, retry := t.retryDelay(req, resp, err, attempt)
+		if !retry || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+
+		attrs := []any{
+			"method", req.Method,
+			"url", req.URL.Redacted(),
+			"attempt", attempt + 1,
+			"max_retries", t.MaxRetries,
+			"reason", reason,
+			"wait", delay.String(),
+		}
+		if resp != nil {
+			attrs = append(attrs, "status", resp.StatusCode)
+			drainBody(resp)
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err.Error())
+		}
+		t.logger().Warn("retrying GitHub API request", attrs...)
+
+		if err := t.doSleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryDelay decides whether a request should be retried and how long to wait before
+func (t *RetryTransport) retryDelay(req *http.Request, resp *http.Response, err error, attempt int) (time.Duration, string, bool) {
+	if err != nil {
+		if !isIdempotentMethod(req.Method) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return 0, "", false
+		}
+		return t.backoff(attempt), "network error", true
+	}
+
+	// Rate limited requests were not processed, so they are safe to retry for every method
+	if delay, reason, ok := t.rateLimitDelay(resp); ok {
+		if delay > t.MaxRateLimitWait {
+			return 0, "", false
+		}
+		return delay, reason, true
+	}
+
+	if resp.StatusCode >= http.StatusInternalServerError && isIdempotentMethod(req.Method) {
+		return t.backoff(attempt), fmt.Sprintf("server error %d", resp.StatusCode), true
+	}
+
+	return 0, "", false
+}
+
+// rateLimitDelay detects primary and secondary rate limit responses and returns the wait time
+func (t *RetryTransport) rateLimitDelay(resp *http.Response) (time.Duration, string, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return 0, "", false
+	}
+
+	if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+		if seconds, err := strconv.Atoi(retryAfter); err == nil {
+			return time.Duration(seconds) * time.Second, "retry-after", true
+		}
+		if at, err := http.ParseTime(retryAfter); err == nil {
+			return max(at.Sub(t.clock()), 0), "retry-after", true
+		}
+	}
+
+	if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			// Add a second of margin as the reset time has a one second resolution
+			return max(time.Unix(reset, 0).Sub(t.clock()), 0) + time.Second, "primary rate limit", true
+		}
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || isSecondaryRateLimit(resp) {
+		return secondaryRateLimitWait, "secondary rate limit", true
+	}
+
+	return 0, "", false
+}
+
+// backoff returns the jittered exponential backoff delay for the attempt
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.BaseDelay << attempt
+	if delay <= 0 || delay > t.MaxDelay {
+		delay = t.MaxDelay
+	}
+
+	// Equal jitter keeps at least half of the delay while spreading concurrent retries
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// pace delays a content-creating request until WriteInterval passed since the previous one
+func (t *RetryTransport) pace(ctx context.Context) error {
+	t.mu.Lock()
+	now := t.clock()
+	wait := t.nextWrite.Sub(now)
+	start := t.nextWrite
+	if now.After(start) {
+		start = now
+	}
+	t.nextWrite = start.Add(t.WriteInterval)
+	t.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	return t.doSleep(ctx, wait)
+}
+
+func (t *RetryTransport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
+
+func (t *RetryTransport) logger() *slog.Logger {
+	if t.Logger != nil {
+		return t.Logger
+	}
+	return slog.Default()
+}
+
+func (t *RetryTransport) clock() time.Time {
+	if t.now != nil {
+		return t.now()
+	}
+	return time.Now()
+}
+
+func (t *RetryTransport) doSleep(ctx context.Context, d time.Duration) error {
+	if t.sleep != nil {
+		return t.sleep(ctx, d)
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// isSecondaryRateLimit checks the body of a 403 response for the secondary rate limit message,
+// the body is restored so the response can still be read by the caller
+func isSecondaryRateLimit(resp *http.Response) bool {
+	if resp.Body == nil {
+		return false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	message := strings.ToLower(string(body))
+	return strings.Contains(message, "secondary rate limit") || strings.Contains(message, "abuse detection")
+}
+
+// rewindRequest returns a copy of the request with a fresh body for a retry
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+
+	clone := req.Clone(req.Context())
+	clone.Body = body
+	return clone, nil
+}
+
+// drainBody discards and closes the response body so the connection can be reused
+func drainBody(resp *http.Response) {
+	if resp.Body == nil {
+		return
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+}
+
+// isIdempotentMethod reports whether repeating a request with the method has no additional effect
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// isWriteMethod reports whether a request with the method creates or modifies content
+func isWriteMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPatch, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,191 @@
+package github
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTransport creates a RetryTransport recording sleeps instead of waiting
+func newTestTransport(now time.Time) (*RetryTransport, *[]time.Duration) {
+	var sleeps []time.Duration
+	transport := NewRetryTransport(nil)
+	transport.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	transport.now = func() time.Time { return now }
+	transport.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return transport, &sleeps
+}
+
+func TestRetryTransportServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	transport, sleeps := newTestTransport(time.Now())
+	client := &http.Client{Transport: transport}
+
+	req, err := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	require.NoError(t, err)
+
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "payload", string(body), "body should be replayed on retry")
+	assert.Equal(t, int32(3), calls.Load())
+	assert.Len(t, *sleeps, 2, "first write should not be paced, each retry should back off")
+}
+
+func TestRetryTransportDoesNotRetryNonIdempotentServerErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	transport, _ := newTestTransport(time.Now())
+	resp, err := (&http.Client{Transport: transport}).Post(server.URL, "application/json", strings.NewReader("{}"))
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestRetryTransportRateLimits(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	tests := []struct {
+		name     string
+		status   int
+		headers  map[string]string
+		body     string
+		wantWait time.Duration
+	}{
+		{
+			name:     "retry after",
+			status:   http.StatusForbidden,
+			headers:  map[string]string{"Retry-After": "30"},
+			wantWait: 30 * time.Second,
+		},
+		{
+			name:   "primary rate limit reset",
+			status: http.StatusForbidden,
+			headers: map[string]string{
+				"X-RateLimit-Remaining": "0",
+				"X-RateLimit-Reset":     strconv.FormatInt(now.Add(2*time.Minute).Unix(), 10),
+			},
+			wantWait: 2*time.Minute + time.Second,
+		},
+		{
+			name:     "secondary rate limit",
+			status:   http.StatusForbidden,
+			body:     `{"message": "You have exceeded a secondary rate limit."}`,
+			wantWait: secondaryRateLimitWait,
+		},
+		{
+			name:     "too many requests",
+			status:   http.StatusTooManyRequests,
+			wantWait: secondaryRateLimitWait,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) == 1 {
+					for k, v := range tt.headers {
+						w.Header().Set(k, v)
+					}
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+					return
+				}
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer server.Close()
+
+			transport, sleeps := newTestTransport(now)
+			transport.WriteInterval = 0
+
+			resp, err := (&http.Client{Transport: transport}).Post(server.URL, "application/json", strings.NewReader("{}"))
+			require.NoError(t, err)
+			resp.Body.Close()
+
+			assert.Equal(t, http.StatusCreated, resp.StatusCode)
+			assert.Equal(t, []time.Duration{tt.wantWait}, *sleeps)
+		})
+	}
+}
+
+func TestRetryTransportForbiddenWithoutRateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"message": "Resource not accessible by integration"}`))
+	}))
+	defer server.Close()
+
+	transport, sleeps := newTestTransport(time.Now())
+	resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	assert.Contains(t, string(body), "Resource not accessible", "body should remain readable")
+	assert.Empty(t, *sleeps)
+}
+
+func TestRetryTransportPacesWrites(t *testing.T) {
+	now := time.Now()
+	transport, sleeps := newTestTransport(now)
+
+	require.NoError(t, transport.pace(context.Background()))
+	require.NoError(t, transport.pace(context.Background()))
+	require.NoError(t, transport.pace(context.Background()))
+
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second}, *sleeps)
+}
+
+func TestRetryTransportBackoff(t *testing.T) {
+	transport := NewRetryTransport(nil)
+
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := transport.backoff(attempt)
+		want := min(transport.BaseDelay<<attempt, transport.MaxDelay)
+		assert.GreaterOrEqual(t, delay, want/2)
+		assert.LessOrEqual(t, delay, want)
+	}
+}
+
+// withoutWritePacing disables the pacing of content-creating requests by the shared
+// transport for the duration of a test
+func withoutWritePacing(t *testing.T) {
+	interval := defaultTransport.WriteInterval
+	defaultTransport.WriteInterval = 0
+	t.Cleanup(func() { defaultTransport.WriteInterval = interval })
+}
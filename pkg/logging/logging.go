@@ -0,0 +1,342 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Format selects how log records are written
+type Format string
+
+const (
+	// FormatActions writes GitHub Actions workflow commands such as ::warning::
+	FormatActions Format = "actions"
+	// FormatText writes key=value lines
+	FormatText Format = "text"
+	// FormatJSON writes one JSON object per line
+	FormatJSON Format = "json"
+)
+
+// LevelNotice sits between info and warning, it's written as a ::notice:: annotation in GitHub Actions
+const LevelNotice = slog.Level(2)
+
+// MaskedText replaces masked secrets in the log output
+const MaskedText = "***"
+
+// annotationKeys are the attributes written as properties of annotations in GitHub Actions
+var annotationKeys = []string{"title", "file", "line", "endLine", "col", "endColumn"}
+
+// ParseFormat validates a log format name, FormatActions when it is empty
+func ParseFormat(value string) (Format, error) {
+	switch format := Format(strings.ToLower(strings.TrimSpace(value))); format {
+	case "":
+		return FormatActions, nil
+	case FormatActions, FormatText, FormatJSON:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unknown log format: %s", value)
+	}
+}
+
+// ParseLevel validates a log level name: debug, info, notice, warning or error
+func ParseLevel(value string) (slog.Level, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info":
+		return slog.LevelInfo, nil
+	case "notice":
+		return LevelNotice, nil
+	case "warning", "warn":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	default:
+		return 0, fmt.Errorf("unknown log level: %s", value)
+	}
+}
+
+// Handler writes log records in one of the supported formats, replacing registered secrets
+// with MaskedText
+type Handler struct {
+	slog.Handler
+	out    *output
+	format Format
+}
+
+// New creates a logger writing records at or above level to w in the given format
+func New(w io.Writer, format Format, level slog.Leveler) *slog.Logger {
+	out := &output{w: w}
+	opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceLevel}
+
+	var handler slog.Handler
+	switch format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(out, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		format = FormatActions
+		handler = &actionsHandler{out: out, level: level}
+	}
+
+	return slog.New(&Handler{Handler: handler, out: out, format: format})
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &Handler{Handler: h.Handler.WithAttrs(attrs), out: h.out, format: h.format}
+}
+
+// WithGroup returns a handler that qualifies the attributes of every record with the group name
+func (h *Handler) WithGroup(name string) slog.Handler {
+	return &Handler{Handler: h.Handler.WithGroup(name), out: h.out, format: h.format}
+}
+
+// AddMask registers a secret that is replaced in everything logged from now on. In
+// GitHub Actions the secret is also masked by the runner in the output of later steps.
+func (h *Handler) AddMask(secret string) {
+	for _, line := range strings.Split(secret, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		h.out.addSecret(line)
+		if h.format == FormatActions {
+			h.out.writeRaw("::add-mask::" + escapeData(line) + "\n")
+		}
+	}
+}
+
+// StartGroup starts a collapsible section of the log
+func (h *Handler) StartGroup(name string) {
+	if h.format == FormatActions {
+		h.out.Write([]byte("::group::" + escapeData(name) + "\n"))
+		return
+	}
+
+	ctx := context.Background()
+	if h.Enabled(ctx, slog.LevelInfo) {
+		h.Handle(ctx, slog.NewRecord(time.Now(), slog.LevelInfo, name, 0))
+	}
+}
+
+// EndGroup ends the section started by StartGroup
+func (h *Handler) EndGroup() {
+	if h.format == FormatActions {
+		h.out.Write([]byte("::endgroup::\n"))
+	}
+}
+
+// AddMask registers a secret with the handler of logger, when it's a Handler
+func AddMask(logger *slog.Logger, secret string) {
+	if h, ok := logger.Handler().(*Handler); ok {
+		h.AddMask(secret)
+	}
+}
+
+// Group starts a collapsible section named name in the log of logger and returns the
+// function that ends it
+func Group(logger *slog.Logger, name string) func() {
+	h, ok := logger.Handler().(*Handler)
+	if !ok {
+		logger.Info(name)
+		return func() {}
+	}
+
+	h.StartGroup(name)
+	return h.EndGroup
+}
+
+// replaceLevel names LevelNotice in text and JSON records
+func replaceLevel(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.LevelKey {
+		if level, ok := a.Value.Any().(slog.Level); ok && level == LevelNotice {
+			a.Value = slog.StringValue("NOTICE")
+		}
+	}
+	return a
+}
+
+// output serializes writes of the handlers and masks the registered secrets
+type output struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets []string
+}
+
+// Write writes p with the secrets masked, every handler writes a record in a single call
+func (o *output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	text := string(p)
+	for _, secret := range o.secrets {
+		text = strings.ReplaceAll(text, secret, MaskedText)
+	}
+	if _, err := io.WriteString(o.w, text); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeRaw writes s without masking it
+func (o *output) writeRaw(s string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	io.WriteString(o.w, s)
+}
+
+// addSecret registers a secret to mask, longer secrets are masked first so one that
+// contains another is not partially revealed
+func (o *output) addSecret(secret string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if slices.Contains(o.secrets, secret) {
+		return
+	}
+	o.secrets = append(o.secrets, secret)
+	slices.SortStableFunc(o.secrets, func(a, b string) int { return len(b) - len(a) })
+}
+
+// actionsHandler writes records as GitHub Actions workflow commands: debug records as
+// ::debug::, notices, warnings and errors as annotations and info records as plain lines
+type actionsHandler struct {
+	out    io.Writer
+	level  slog.Leveler
+	attrs  []slog.Attr
+	prefix string
+}
+
+// Enabled reports whether records at level are written
+func (h *actionsHandler) Enabled(_ context.Context, level slog.Level) bool {
+	threshold := slog.LevelInfo
+	if h.level != nil {
+		threshold = h.level.Level()
+	}
+	return level >= threshold
+}
+
+// Handle writes the record as a single line
+func (h *actionsHandler) Handle(_ context.Context, r slog.Record) error {
+	command := levelCommand(r.Level)
+
+	var properties []string
+	var message strings.Builder
+	message.WriteString(r.Message)
+
+	add := func(a slog.Attr) {
+		if command != "" && command != "debug" && slices.Contains(annotationKeys, a.Key) {
+			properties = append(properties, a.Key+"="+escapeProperty(a.Value.String()))
+			return
+		}
+		message.WriteString(" " + a.Key + "=" + quoteValue(a.Value.String()))
+	}
+
+	for _, a := range h.attrs {
+		add(a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		for _, flat := range flattenAttr(h.prefix, a) {
+			add(flat)
+		}
+		return true
+	})
+
+	if command == "" {
+		_, err := io.WriteString(h.out, message.String()+"\n")
+		return err
+	}
+
+	line := "::" + command
+	if len(properties) > 0 {
+		line += " " + strings.Join(properties, ",")
+	}
+	line += "::" + escapeData(message.String()) + "\n"
+	_, err := io.WriteString(h.out, line)
+	return err
+}
+
+// WithAttrs returns a handler that adds attrs to every record
+func (h *actionsHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = slices.Clone(h.attrs)
+	for _, a := range attrs {
+		clone.attrs = append(clone.attrs, flattenAttr(h.prefix, a)...)
+	}
+	return &clone
+}
+
+// WithGroup returns a handler that qualifies the keys of later attributes with the group name
+func (h *actionsHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// levelCommand returns the workflow command for records at level, none for info records
+func levelCommand(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < LevelNotice:
+		return ""
+	case level < slog.LevelWarn:
+		return "notice"
+	case level < slog.LevelError:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// flattenAttr resolves an attribute, expanding groups into attributes with qualified keys
+func flattenAttr(prefix string, a slog.Attr) []slog.Attr {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return nil
+	}
+
+	if a.Value.Kind() != slog.KindGroup {
+		a.Key = prefix + a.Key
+		return []slog.Attr{a}
+	}
+
+	groupPrefix := prefix
+	if a.Key != "" {
+		groupPrefix += a.Key + "."
+	}
+	var attrs []slog.Attr
+	for _, member := range a.Value.Group() {
+		attrs = append(attrs, flattenAttr(groupPrefix, member)...)
+	}
+	return attrs
+}
+
+// quoteValue quotes an attribute value when it would be ambiguous in a key=value list
+func quoteValue(value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\r\n\"=") {
+		return strconv.Quote(value)
+	}
+	return value
+}
+
+// escapeData escapes the message of a workflow command
+func escapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeProperty escapes a property value of a workflow command
+func escapeProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
@@ -0,0 +1,117 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, FormatActions, format)
+
+	format, err = ParseFormat(" JSON ")
+	require.NoError(t, err)
+	assert.Equal(t, FormatJSON, format)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestParseLevel(t *testing.T) {
+	level, err := ParseLevel("Notice")
+	require.NoError(t, err)
+	assert.Equal(t, LevelNotice, level)
+
+	level, err = ParseLevel("warn")
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelWarn, level)
+
+	_, err = ParseLevel("verbose")
+	assert.Error(t, err)
+}
+
+func TestActionsFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatActions, slog.LevelDebug)
+
+	logger.Debug("getting file contents", "path", "main.go", "branch", "feature x")
+	logger.Info("created issue", "url", "https://github.com/o/r/issues/1")
+	logger.Log(context.Background(), LevelNotice, "ledger saved")
+	logger.With("file", "main.go").Warn("secrets masked", "line", 3, "detectors", "email address")
+	logger.WithGroup("issue").Error("failed to create issue\nforbidden", "status", 403)
+
+	assert.Equal(t, []string{
+		`::debug::getting file contents path=main.go branch="feature x"`,
+		`created issue url=https://github.com/o/r/issues/1`,
+		`::notice::ledger saved`,
+		`::warning file=main.go,line=3::secrets masked detectors="email address"`,
+		`::error::failed to create issue%0Aforbidden issue.status=403`,
+	}, strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n"))
+}
+
+func TestActionsFormatLevel(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatActions, slog.LevelInfo)
+
+	logger.Debug("hidden")
+	logger.Info("shown")
+
+	assert.Equal(t, "shown\n", buf.String())
+}
+
+func TestAddMask(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatActions, slog.LevelInfo)
+
+	AddMask(logger, "ghs_secret")
+	logger.Info("token refreshed", "token", "ghs_secret")
+
+	assert.Equal(t, "::add-mask::ghs_secret\ntoken refreshed token=***\n", buf.String())
+
+	// Other formats mask secrets without workflow commands
+	buf.Reset()
+	logger = New(&buf, FormatJSON, slog.LevelInfo)
+	AddMask(logger, "-----BEGIN KEY-----\nc2VjcmV0\n-----END KEY-----\n")
+	logger.Info("loaded key", "key", "c2VjcmV0")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, MaskedText, record["key"])
+}
+
+func TestJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatJSON, slog.LevelDebug)
+
+	logger.Log(context.Background(), LevelNotice, "ledger saved", "path", ".pdd/ledger.json")
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "NOTICE", record["level"])
+	assert.Equal(t, "ledger saved", record["msg"])
+	assert.Equal(t, ".pdd/ledger.json", record["path"])
+}
+
+func TestGroup(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, FormatActions, slog.LevelInfo)
+
+	end := Group(logger, "Creating issues")
+	logger.Info("created issue")
+	end()
+
+	assert.Equal(t, "::group::Creating issues\ncreated issue\n::endgroup::\n", buf.String())
+
+	buf.Reset()
+	logger = New(&buf, FormatText, slog.LevelInfo)
+	Group(logger, "Creating issues")()
+	assert.Contains(t, buf.String(), `msg="Creating issues"`)
+}
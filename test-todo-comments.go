@@ -1,3 +1,6 @@
+// pdd:disable-file
+// Sample puzzles used to try the action, they must not become issues.
+
 package main
 
 import "fmt"